@@ -1,6 +1,6 @@
 module github.com/techarm/toolkit
 
-go 1.18
+go 1.21
 
 // retract (
 // 	// Published v1 too early
@@ -8,12 +8,8 @@ go 1.18
 // )
 
 require (
-	github.com/elliotchance/orderedmap/v2 v2.0.1
 	github.com/go-stack/stack v1.8.1
 	github.com/mattn/go-isatty v0.0.16
-)
-
-require (
-	golang.org/x/exp v0.0.0-20220321173239-a90fa8a75705 // indirect
-	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
+	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,263 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminHandler returns an http.Handler for inspecting and changing log
+// levels at runtime, meant to be mounted on an internal admin mux:
+//
+//	mux.Handle("/debug/log", log.AdminHandler())
+//
+// GET responds with the levels set with SetLevel, the patterns having a
+// handler set with SetNamedHandler and every named logger with its
+// effective level, as JSON. The root logger and unnamed loggers are listed
+// with an empty name. Loggers without a level let every record through
+// and are reported at the trace level.
+//
+// PUT sets the level of a pattern, as SetLevel does, from a JSON body:
+//
+//	{"name": "db.*", "level": "debug", "ttl": "10m"}
+//
+// An empty name or "*" sets the global level. An empty level clears the
+// level of the pattern. If ttl is given, the previous level of the pattern
+// is restored once it has passed, unless the pattern was changed through
+// the handler in the meantime. A temporary level set while another one is
+// in effect replaces it, and restores the level from before the first.
+func AdminHandler() http.Handler {
+	return adminHandler{}
+}
+
+type adminHandler struct{}
+
+type adminRequest struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	TTL   string `json:"ttl"`
+}
+
+type adminLogger struct {
+	Name    string `json:"name"`
+	Level   string `json:"level"`
+	Pattern string `json:"pattern,omitempty"`
+	Handler string `json:"handler,omitempty"`
+}
+
+type adminOverride struct {
+	Pattern string    `json:"pattern"`
+	Level   string    `json:"level"`
+	Expires time.Time `json:"expires"`
+
+	// the level of the pattern before the first of the overrides in
+	// effect, which is restored once they have all expired
+	prev    LEVEL
+	hadPrev bool
+}
+
+type adminState struct {
+	Levels    map[string]string `json:"levels"`
+	Handlers  []string          `json:"handlers"`
+	Loggers   []adminLogger     `json:"loggers"`
+	Overrides []adminOverride   `json:"overrides,omitempty"`
+}
+
+func (a adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut:
+		if err := a.put(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(a.state())
+}
+
+func (a adminHandler) put(r *http.Request) error {
+	var req adminRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return fmt.Errorf("log: invalid request: %v", err)
+	}
+
+	pattern := strings.TrimSpace(req.Name)
+	if pattern == "" {
+		pattern = "*"
+	}
+	if err := validPattern(pattern); err != nil {
+		return err
+	}
+
+	var lvl LEVEL
+	unset := req.Level == ""
+	if !unset {
+		var err error
+		if lvl, err = LevelFromString(req.Level); err != nil {
+			return fmt.Errorf("log: invalid level %q", req.Level)
+		}
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			return fmt.Errorf("log: invalid ttl %q", req.TTL)
+		}
+	}
+
+	overrides.apply(pattern, lvl, unset, ttl)
+	return nil
+}
+
+func (a adminHandler) state() adminState {
+	reg := loadRegistry()
+	st := adminState{
+		Levels:   make(map[string]string),
+		Handlers: []string{},
+	}
+	if reg != nil {
+		for pattern, lvl := range reg.levels {
+			st.Levels[pattern] = lvl.String()
+		}
+		for pattern := range reg.handlers {
+			st.Handlers = append(st.Handlers, pattern)
+		}
+		sort.Strings(st.Handlers)
+	}
+
+	names := []string{""}
+	loggerNames.Range(func(k, _ interface{}) bool {
+		names = append(names, k.(string))
+		return true
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		l := adminLogger{Name: name, Level: LevelTrace.String()}
+		if lvl, pattern, ok := reg.levelPattern(name); ok {
+			l.Level, l.Pattern = lvl.String(), pattern
+		}
+		lookupPatterns(name, func(pattern string) bool {
+			if reg != nil && reg.handlers[pattern] != nil {
+				l.Handler = pattern
+				return true
+			}
+			return false
+		})
+		st.Loggers = append(st.Loggers, l)
+	}
+
+	st.Overrides = overrides.list()
+	return st
+}
+
+// validPattern checks that pattern is "*", a logger name or a logger name
+// followed by ".*".
+func validPattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+	name := strings.TrimSuffix(pattern, ".*")
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || strings.ContainsAny(part, "*?[") {
+			return fmt.Errorf("log: invalid logger pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// overrides tracks the levels set through AdminHandlers.
+var overrides = &overrideList{
+	gens: make(map[string]uint64),
+	m:    make(map[string]adminOverride),
+}
+
+type overrideList struct {
+	mu sync.Mutex
+
+	// gens counts the changes made to each pattern, so that an expiring
+	// override doesn't revert a later change
+	gens map[string]uint64
+
+	// m holds the temporary levels which haven't expired yet
+	m map[string]adminOverride
+}
+
+// apply sets or, if unset is true, clears the level of pattern. If ttl is
+// positive, the level the pattern had before any temporary override is
+// restored after ttl, unless another change was made in the meantime.
+func (o *overrideList) apply(pattern string, lvl LEVEL, unset bool, ttl time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.gens[pattern]++
+	gen := o.gens[pattern]
+	prev, hadPrev := loadRegistry().exactLevel(pattern)
+	if ov, ok := o.m[pattern]; ok {
+		// an override of an override restores the original level
+		prev, hadPrev = ov.prev, ov.hadPrev
+	}
+
+	if unset {
+		ClearLevel(pattern)
+	} else {
+		SetLevel(pattern, lvl)
+	}
+
+	if ttl <= 0 {
+		delete(o.m, pattern)
+		return
+	}
+
+	ov := adminOverride{
+		Pattern: pattern,
+		Level:   lvl.String(),
+		Expires: time.Now().Add(ttl),
+		prev:    prev,
+		hadPrev: hadPrev,
+	}
+	if unset {
+		ov.Level = ""
+	}
+	o.m[pattern] = ov
+
+	time.AfterFunc(ttl, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.gens[pattern] != gen {
+			return
+		}
+		delete(o.m, pattern)
+		if hadPrev {
+			SetLevel(pattern, prev)
+		} else {
+			ClearLevel(pattern)
+		}
+	})
+}
+
+func (o *overrideList) list() []adminOverride {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var list []adminOverride
+	for _, ov := range o.m {
+		list = append(list, ov)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Pattern < list[j].Pattern })
+	return list
+}
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// adminLevels sends a request to an AdminHandler and returns the levels
+// it reports.
+func adminLevels(t *testing.T, method, body string) map[string]string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(w, httptest.NewRequest(method, "/", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s: %d %s", method, body, w.Code, w.Body)
+	}
+	var st adminState
+	if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	return st.Levels
+}
+
+func TestAdminHandlerStackedOverrides(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("db.*") })
+
+	for _, test := range []struct {
+		name   string
+		first  string
+		second string
+	}{
+		{"ShorterSecond", "300ms", "50ms"},
+		{"LongerSecond", "50ms", "150ms"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			SetLevel("db.*", LevelWarning)
+			adminLevels(t, http.MethodPut, `{"name":"db.*","level":"debug","ttl":"`+test.first+`"}`)
+			levels := adminLevels(t, http.MethodPut, `{"name":"db.*","level":"trace","ttl":"`+test.second+`"}`)
+			if levels["db.*"] != LevelTrace.String() {
+				t.Fatalf("level is %q during the overrides", levels["db.*"])
+			}
+
+			time.Sleep(400 * time.Millisecond)
+			if levels := adminLevels(t, http.MethodGet, ""); levels["db.*"] != LevelWarning.String() {
+				t.Errorf("level is %q after the overrides expired, want %q", levels["db.*"], LevelWarning.String())
+			}
+		})
+	}
+}
+
+func TestAdminHandlerOverrideWithoutLevel(t *testing.T) {
+	t.Cleanup(func() { ClearLevel("cache") })
+
+	adminLevels(t, http.MethodPut, `{"name":"cache","level":"debug","ttl":"50ms"}`)
+	adminLevels(t, http.MethodPut, `{"name":"cache","level":"info","ttl":"50ms"}`)
+	time.Sleep(150 * time.Millisecond)
+	if level, ok := adminLevels(t, http.MethodGet, "")["cache"]; ok {
+		t.Errorf("level is %q after the overrides expired, want none", level)
+	}
+}
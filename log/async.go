@@ -0,0 +1,240 @@
+package log
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what an AsyncHandler does with a record when its
+// queue is full.
+type OverflowPolicy int
+
+// List of predefined overflow policies
+const (
+	// OverflowBlock waits until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the record being logged.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued record to make room.
+	OverflowDropOldest
+	// OverflowDropBelow discards records below AsyncOptions.DropLevel and
+	// blocks for all others.
+	OverflowDropBelow
+)
+
+const (
+	defaultQueueSize      = 1024
+	defaultReportInterval = 10 * time.Second
+)
+
+var errHandlerClosed = errors.New("log: handler is closed")
+
+// AsyncOptions configures an AsyncHandler.
+type AsyncOptions struct {
+	// QueueSize is the number of records that can be queued.
+	// Defaults to 1024.
+	QueueSize int
+
+	// Overflow is the behaviour when the queue is full.
+	Overflow OverflowPolicy
+
+	// DropLevel is the level below which records are dropped when the
+	// queue is full and Overflow is OverflowDropBelow.
+	DropLevel LEVEL
+
+	// ReportInterval is how often the number of dropped records is
+	// written as a record of its own. Defaults to 10 seconds.
+	ReportInterval time.Duration
+}
+
+// AsyncHandler returns a handler which queues records and writes them to
+// h from a background goroutine, so that logging does not wait on slow
+// writers. When the queue is full opts.Overflow decides whether the caller
+// waits or a record is dropped. Dropped records are counted and reported
+// every opts.ReportInterval as a warning on h.
+//
+// Flushing the handler waits until every record queued before the call has
+// been written. Closing it writes the remaining records, stops the
+// goroutine and closes h. Records are written after Log returns, so any
+// Lazy values are evaluated on the background goroutine.
+func AsyncHandler(h Handler, opts AsyncOptions) Handler {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.ReportInterval <= 0 {
+		opts.ReportInterval = defaultReportInterval
+	}
+
+	a := &asyncHandler{
+		h:     h,
+		opts:  opts,
+		queue: make(chan asyncItem, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// asyncItem is either a record to write or, if flushed is set, a marker
+// which is signalled once every earlier record has been written.
+type asyncItem struct {
+	r       *Record
+	flushed chan struct{}
+}
+
+type asyncHandler struct {
+	h       Handler
+	opts    AsyncOptions
+	queue   chan asyncItem
+	done    chan struct{}
+	dropped int64
+
+	// mu guards closed; Log holds it for reading while it sends on the
+	// queue so that Close never closes the channel under a sender.
+	mu     sync.RWMutex
+	closed bool
+
+	// markers are the flush markers OverflowDropOldest took off the
+	// queue to make room. Every record before them has been received
+	// by run, which signals them before it writes the next one.
+	markerMu sync.Mutex
+	markers  []chan struct{}
+}
+
+func (a *asyncHandler) Log(r *Record) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return errHandlerClosed
+	}
+
+	item := asyncItem{r: r}
+	switch a.opts.Overflow {
+	case OverflowDropNewest:
+		select {
+		case a.queue <- item:
+		default:
+			atomic.AddInt64(&a.dropped, 1)
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case a.queue <- item:
+				return nil
+			default:
+			}
+			select {
+			case old := <-a.queue:
+				if old.flushed != nil {
+					// never lose a flush marker, hand it to run
+					a.markerMu.Lock()
+					a.markers = append(a.markers, old.flushed)
+					a.markerMu.Unlock()
+					continue
+				}
+				atomic.AddInt64(&a.dropped, 1)
+			default:
+			}
+		}
+
+	case OverflowDropBelow:
+		if r.Level >= a.opts.DropLevel {
+			a.queue <- item
+			return nil
+		}
+		select {
+		case a.queue <- item:
+		default:
+			atomic.AddInt64(&a.dropped, 1)
+		}
+
+	default:
+		a.queue <- item
+	}
+	return nil
+}
+
+func (a *asyncHandler) Flush() error {
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return nil
+	}
+	flushed := make(chan struct{})
+	a.queue <- asyncItem{flushed: flushed}
+	a.mu.RUnlock()
+
+	<-flushed
+	return flushHandler(a.h)
+}
+
+func (a *asyncHandler) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	return closeHandler(a.h)
+}
+
+func (a *asyncHandler) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.opts.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item, ok := <-a.queue:
+			a.signalMarkers()
+			if !ok {
+				a.reportDropped()
+				return
+			}
+			if item.flushed != nil {
+				a.reportDropped()
+				close(item.flushed)
+				continue
+			}
+			a.h.Log(item.r)
+
+		case <-ticker.C:
+			a.reportDropped()
+		}
+	}
+}
+
+// signalMarkers signals the flush markers taken off the queue by Log.
+func (a *asyncHandler) signalMarkers() {
+	a.markerMu.Lock()
+	markers := a.markers
+	a.markers = nil
+	a.markerMu.Unlock()
+
+	if len(markers) == 0 {
+		return
+	}
+	a.reportDropped()
+	for _, flushed := range markers {
+		close(flushed)
+	}
+}
+
+// reportDropped writes a warning with the number of records dropped since
+// the last report, if any.
+func (a *asyncHandler) reportDropped() {
+	n := atomic.SwapInt64(&a.dropped, 0)
+	if n == 0 {
+		return
+	}
+	a.h.Log(droppedRecord(n))
+}
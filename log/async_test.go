@@ -0,0 +1,82 @@
+package log
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncHandlerDropOldestFlush(t *testing.T) {
+	writing, release := make(chan struct{}, 1), make(chan struct{})
+	h := &recorder{}
+	a := AsyncHandler(FuncHandler(func(r *Record) error {
+		select {
+		case writing <- struct{}{}:
+		default:
+		}
+		<-release
+		return h.Log(r)
+	}), AsyncOptions{QueueSize: 2, Overflow: OverflowDropOldest})
+	defer closeHandler(a)
+
+	// the first record blocks the writer, the marker is next in the queue
+	a.Log(testRecord("first"))
+	<-writing
+	flushed := make(chan error)
+	go func() { flushed <- flushHandler(a) }()
+	for deadline := time.Now().Add(5 * time.Second); len(a.(*asyncHandler).queue) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Flush did not queue a marker")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// loggers racing for the room left by the marker never wait
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a.Log(testRecord("more"))
+			}
+		}()
+	}
+	logged := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(logged)
+	}()
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Log blocked while the queue was full")
+	}
+
+	close(release)
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Flush did not return")
+	}
+	if err := closeHandler(a); err != nil {
+		t.Fatal(err)
+	}
+	if h.records[0].Message != "first" {
+		t.Errorf("first record is %q", h.records[0].Message)
+	}
+	var written, dropped int
+	for _, r := range h.records {
+		if r.Message == "dropped log records" {
+			dropped += toInt(recordValues(r)["dropped"][0])
+		} else {
+			written++
+		}
+	}
+	if written+dropped != 801 {
+		t.Errorf("got %d records written and %d dropped, want 801 in all", written, dropped)
+	}
+}
@@ -0,0 +1,46 @@
+package log
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoffDefaults sets min to defaultMin if it isn't positive and max to
+// defaultMax, or min if that is larger, if it is less than min.
+func backoffDefaults(min, max *time.Duration, defaultMin, defaultMax time.Duration) {
+	if *min <= 0 {
+		*min = defaultMin
+	}
+	if *max < *min {
+		*max = defaultMax
+		if *max < *min {
+			*max = *min
+		}
+	}
+}
+
+// backoffDelay returns backoff plus up to 10% jitter, so that many clients
+// don't retry in lockstep.
+func backoffDelay(backoff time.Duration) time.Duration {
+	return backoff + time.Duration(rand.Int63n(int64(backoff)/10+1))
+}
+
+// nextBackoff doubles backoff up to max.
+func nextBackoff(backoff, max time.Duration) time.Duration {
+	if backoff *= 2; backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// droppedRecord returns the warning written in place of n records which
+// were dropped.
+func droppedRecord(n int64) *Record {
+	return &Record{
+		Time:     time.Now(),
+		Level:    LevelWarning,
+		Message:  "dropped log records",
+		Context:  []interface{}{"dropped", n},
+		KeyNames: defaultKeyNames,
+	}
+}
@@ -0,0 +1,490 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables read by Config.ApplyEnv
+const (
+	EnvLevel   = "TOOLKIT_LOG_LEVEL"
+	EnvFormat  = "TOOLKIT_LOG_FORMAT"
+	EnvModules = "TOOLKIT_LOG_MODULES"
+	EnvOutput  = "TOOLKIT_LOG_OUTPUT"
+)
+
+// Config describes how the root logger writes its records, see Configure.
+type Config struct {
+	// Level is the minimum level of the records written, "info" by
+	// default.
+	Level string `json:"level" yaml:"level"`
+
+	// Format is the format of the outputs which don't set one: "terminal",
+	// "logfmt" or "json". By default standard output and standard error
+	// use the terminal format if they are a terminal and logfmt
+	// otherwise, files and syslog use logfmt.
+	Format string `json:"format" yaml:"format"`
+
+	// Modules sets levels per package or source file, in the syntax
+	// accepted by ParseModuleLevels. Modules not listed use Level.
+	Modules string `json:"modules" yaml:"modules"`
+
+	// Loggers maps patterns of named loggers to their level, as set by
+	// SetLevel.
+	Loggers map[string]string `json:"loggers" yaml:"loggers"`
+
+	// Outputs are the destinations records are written to. Standard
+	// output is used if there are none.
+	Outputs []OutputConfig `json:"outputs" yaml:"outputs"`
+}
+
+// OutputConfig describes one output of a Config. Outputs of type "multi"
+// hold further outputs, forming a tree.
+type OutputConfig struct {
+	// Type is one of "stdout", "stderr", "file", "syslog" or "multi". If
+	// it is empty, it is "multi" for outputs with Outputs, "file" for
+	// outputs with a Path and "stdout" otherwise.
+	Type string `json:"type" yaml:"type"`
+
+	// Level is the minimum level of the records written to this output,
+	// on top of the level of its parents.
+	Level string `json:"level" yaml:"level"`
+
+	// Format overrides the format of this output and its children.
+	Format string `json:"format" yaml:"format"`
+
+	// Path is the file written by file outputs.
+	Path string `json:"path" yaml:"path"`
+
+	// Rotate enables rotation of file outputs.
+	Rotate *RotateConfig `json:"rotate" yaml:"rotate"`
+
+	// Network and Address select a remote syslog server, such as "udp"
+	// and "logs.example.com:514". The local syslog daemon is used if they
+	// are empty.
+	Network string `json:"network" yaml:"network"`
+	Address string `json:"address" yaml:"address"`
+
+	// AppName is the syslog application name.
+	AppName string `json:"app_name" yaml:"app_name"`
+
+	// Async writes the records of this output from a background
+	// goroutine, see AsyncHandler.
+	Async bool `json:"async" yaml:"async"`
+
+	// Outputs are the children of a multi output.
+	Outputs []OutputConfig `json:"outputs" yaml:"outputs"`
+}
+
+// RotateConfig holds the RotateOptions of a file output. Durations are
+// written as accepted by time.ParseDuration, such as "24h".
+type RotateConfig struct {
+	MaxSize    int64  `json:"max_size" yaml:"max_size"`
+	Interval   string `json:"interval" yaml:"interval"`
+	MaxBackups int    `json:"max_backups" yaml:"max_backups"`
+	MaxAge     string `json:"max_age" yaml:"max_age"`
+	Compress   bool   `json:"compress" yaml:"compress"`
+	Symlink    string `json:"symlink" yaml:"symlink"`
+	LocalTime  bool   `json:"local_time" yaml:"local_time"`
+}
+
+// LoadConfig reads a Config from a JSON or YAML file, depending on the
+// extension of path. Unknown keys are reported as errors.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+	default:
+		return cfg, fmt.Errorf("log: unknown configuration file type %q", path)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("log: %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// ApplyEnv overrides c with the environment variables which are set:
+// TOOLKIT_LOG_LEVEL sets Level, TOOLKIT_LOG_FORMAT sets Format,
+// TOOLKIT_LOG_MODULES sets Modules and TOOLKIT_LOG_OUTPUT replaces the
+// outputs by "stdout", "stderr" or the file of the given path.
+func (c *Config) ApplyEnv() {
+	if v, ok := os.LookupEnv(EnvLevel); ok {
+		c.Level = v
+	}
+	if v, ok := os.LookupEnv(EnvFormat); ok {
+		c.Format = v
+	}
+	if v, ok := os.LookupEnv(EnvModules); ok {
+		c.Modules = v
+	}
+	if v, ok := os.LookupEnv(EnvOutput); ok && v != "" {
+		switch v {
+		case "stdout", "stderr":
+			c.Outputs = []OutputConfig{{Type: v}}
+		default:
+			c.Outputs = []OutputConfig{{Type: "file", Path: v}}
+		}
+	}
+}
+
+var (
+	configMu      sync.Mutex
+	configHandler *reloadHandler
+	configLoggers []string
+)
+
+// Configure builds the handlers described by cfg and makes the root logger
+// write to them. Loggers derived from the root logger follow. The whole
+// configuration is validated first; if it is invalid, an error naming the
+// offending setting is returned and nothing is changed.
+//
+// Configure may be called again to reload the configuration. Records
+// being written while the handlers are replaced go to either the old or
+// the new handlers, none are lost. The old handlers are flushed and closed
+// afterwards.
+func Configure(cfg Config) error {
+	levels := make(map[string]LEVEL, len(cfg.Loggers))
+	for pattern, level := range cfg.Loggers {
+		if err := validPattern(pattern); err != nil {
+			return fmt.Errorf("log: loggers: %v", strings.TrimPrefix(err.Error(), "log: "))
+		}
+		lvl, err := LevelFromString(level)
+		if err != nil {
+			return fmt.Errorf("log: loggers[%s]: unknown level %q", pattern, level)
+		}
+		levels[pattern] = lvl
+	}
+
+	// rotating file handlers don't compress or remove old files before
+	// the handlers they replace are closed
+	hold := make(chan struct{})
+	defer close(hold)
+
+	h, err := cfg.build(hold)
+	if err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	for _, pattern := range configLoggers {
+		ClearLevel(pattern)
+	}
+	configLoggers = configLoggers[:0]
+	for pattern, lvl := range levels {
+		SetLevel(pattern, lvl)
+		configLoggers = append(configLoggers, pattern)
+	}
+
+	if configHandler == nil {
+		configHandler = &reloadHandler{h: h}
+		root.SetHandler(configHandler)
+		return nil
+	}
+
+	old := configHandler.swap(h)
+	root.SetHandler(configHandler)
+	err = flushHandler(old)
+	if cerr := closeHandler(old); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReloadOnSignal calls load and applies its configuration with Configure
+// whenever the process receives SIGHUP. Errors are logged on the root
+// logger, leaving the current configuration in place. The returned
+// function stops watching for the signal.
+func ReloadOnSignal(load func() (Config, error)) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+				cfg, err := load()
+				if err == nil {
+					err = Configure(cfg)
+				}
+				if err != nil {
+					root.Log(LevelError, "reloading log configuration failed", Err(err))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// reloadHandler writes to a handler which can be replaced while records
+// are being written. Unlike swapHandler, swap waits for the records being
+// written to the old handler, so that it can be closed safely.
+type reloadHandler struct {
+	mu sync.RWMutex
+	h  Handler
+}
+
+func (h *reloadHandler) Log(r *Record) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.h.Log(r)
+}
+
+func (h *reloadHandler) swap(nh Handler) Handler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.h
+	h.h = nh
+	return old
+}
+
+func (h *reloadHandler) Flush() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return flushHandler(h.h)
+}
+
+func (h *reloadHandler) Close() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return closeHandler(h.h)
+}
+
+// build validates c and returns its handler tree. Rotating file handlers
+// don't touch old files before hold is closed.
+func (c *Config) build(hold <-chan struct{}) (Handler, error) {
+	level := LevelInfo
+	if c.Level != "" {
+		var err error
+		if level, err = LevelFromString(c.Level); err != nil {
+			return nil, fmt.Errorf("log: level: unknown level %q", c.Level)
+		}
+	}
+	if c.Format != "" {
+		if _, err := formatByName(c.Format, false); err != nil {
+			return nil, fmt.Errorf("log: format: %v", err)
+		}
+	}
+	rules, err := ParseModuleLevels(c.Modules)
+	if err != nil {
+		return nil, fmt.Errorf("log: modules: %v", strings.TrimPrefix(err.Error(), "log: "))
+	}
+
+	outputs := c.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Type: "stdout"}}
+	}
+	h, err := buildOutputs("outputs", outputs, c.Format, hold)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rules) > 0 {
+		return ModuleFilterHandler(level, rules, h), nil
+	}
+	return LvlFilterHandler(level, h), nil
+}
+
+// buildOutputs returns a handler writing to all outputs. If one of them is
+// invalid, the handlers already opened are closed.
+func buildOutputs(path string, outputs []OutputConfig, format string, hold <-chan struct{}) (Handler, error) {
+	hs := make([]Handler, 0, len(outputs))
+	for i := range outputs {
+		h, err := outputs[i].build(fmt.Sprintf("%s[%d]", path, i), format, hold)
+		if err != nil {
+			for _, h := range hs {
+				closeHandler(h)
+			}
+			return nil, err
+		}
+		hs = append(hs, h)
+	}
+	if len(hs) == 1 {
+		return hs[0], nil
+	}
+	return MultiHandler(hs...), nil
+}
+
+func (o *OutputConfig) build(path, format string, hold <-chan struct{}) (Handler, error) {
+	errorf := func(f string, args ...interface{}) error {
+		return fmt.Errorf("log: %s: %s", path, fmt.Sprintf(f, args...))
+	}
+
+	var level LEVEL
+	if o.Level != "" {
+		var err error
+		if level, err = LevelFromString(o.Level); err != nil {
+			return nil, errorf("unknown level %q", o.Level)
+		}
+	}
+	if o.Format != "" {
+		format = o.Format
+	}
+
+	typ := o.Type
+	if typ == "" {
+		switch {
+		case len(o.Outputs) > 0:
+			typ = "multi"
+		case o.Path != "":
+			typ = "file"
+		default:
+			typ = "stdout"
+		}
+	}
+	if typ != "multi" && len(o.Outputs) > 0 {
+		return nil, errorf("outputs are only allowed for multi outputs")
+	}
+	if typ != "file" && (o.Path != "" || o.Rotate != nil) {
+		return nil, errorf("path and rotate are only allowed for file outputs")
+	}
+
+	var h Handler
+	switch typ {
+	case "stdout", "stderr":
+		f := os.Stdout
+		if typ == "stderr" {
+			f = os.Stderr
+		}
+		fmtr, err := formatByName(format, isatty.IsTerminal(f.Fd()))
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		h = StreamHandler(f, fmtr)
+
+	case "file":
+		if o.Path == "" {
+			return nil, errorf("path is required for file outputs")
+		}
+		fmtr, err := formatByName(format, false)
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		if o.Rotate == nil {
+			h, err = FileHandler(o.Path, fmtr)
+		} else {
+			var opts RotateOptions
+			if opts, err = o.Rotate.options(); err != nil {
+				return nil, errorf("rotate: %v", err)
+			}
+			h, err = newRotatingFileHandler(o.Path, fmtr, opts, hold)
+		}
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+
+	case "syslog":
+		if (o.Network == "") != (o.Address == "") {
+			return nil, errorf("network and address must be set together")
+		}
+		fmtr, err := formatByName(format, false)
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		opts := SyslogOptions{AppName: o.AppName, Format: fmtr}
+		if o.Network == "" {
+			h, err = SyslogHandler(opts)
+		} else {
+			h, err = SyslogNetHandler(o.Network, o.Address, opts)
+		}
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+
+	case "multi":
+		if len(o.Outputs) == 0 {
+			return nil, errorf("multi outputs need at least one output")
+		}
+		var err error
+		if h, err = buildOutputs(path+".outputs", o.Outputs, format, hold); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errorf("unknown type %q", typ)
+	}
+
+	if o.Async {
+		h = AsyncHandler(h, AsyncOptions{})
+	}
+	if level > LevelTrace {
+		h = LvlFilterHandler(level, h)
+	}
+	return h, nil
+}
+
+func (c *RotateConfig) options() (RotateOptions, error) {
+	opts := RotateOptions{
+		MaxSize:    c.MaxSize,
+		MaxBackups: c.MaxBackups,
+		Compress:   c.Compress,
+		Symlink:    c.Symlink,
+		LocalTime:  c.LocalTime,
+	}
+	var err error
+	if c.Interval != "" {
+		if opts.Interval, err = time.ParseDuration(c.Interval); err != nil {
+			return opts, fmt.Errorf("interval: %v", err)
+		}
+	}
+	if c.MaxAge != "" {
+		if opts.MaxAge, err = time.ParseDuration(c.MaxAge); err != nil {
+			return opts, fmt.Errorf("max_age: %v", err)
+		}
+	}
+	return opts, nil
+}
+
+// formatByName returns the Format called name. An empty name selects the
+// terminal format if terminal is set and logfmt otherwise.
+func formatByName(name string, terminal bool) (Format, error) {
+	switch strings.ToLower(name) {
+	case "":
+		if terminal {
+			return TerminalFormatterDefault(), nil
+		}
+		return LogfmtFormat(), nil
+	case "terminal":
+		return TerminalFormatterDefault(), nil
+	case "logfmt":
+		return LogfmtFormat(), nil
+	case "json":
+		return JsonFormat(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+}
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"context"
+	"sync"
+)
+
+type loggerKey struct{}
+
+// contextKey is a context key registered with RegisterContextKey.
+type contextKey struct {
+	name string
+	key  interface{}
+}
+
+var (
+	contextKeysMu sync.RWMutex
+	contextKeys   []contextKey
+)
+
+// NewContext returns a copy of ctx which carries l. The logger can be
+// retrieved with FromContext further down the call chain.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the Logger stored in ctx by NewContext, or the root
+// logger if there is none or ctx is nil.
+func FromContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return root
+	}
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return root
+}
+
+// contextLogger returns the logger stored in ctx if it was created by this
+// package, the root logger otherwise.
+func contextLogger(ctx context.Context) *logger {
+	if ctx == nil {
+		return root
+	}
+	if l, ok := ctx.Value(loggerKey{}).(*logger); ok {
+		return l
+	}
+	return root
+}
+
+// RegisterContextKey registers a context key whose value is added to the
+// record context under the given name by the *Context logging methods,
+// whenever ctx carries a value for it. For example, with
+//
+//	log.RegisterContextKey("request_id", requestIDKey{})
+//
+// a call to log.InfoContext(ctx, "done") on a request context logs
+// "done request_id=...". Registering the same name again replaces the key.
+func RegisterContextKey(name string, key interface{}) {
+	contextKeysMu.Lock()
+	defer contextKeysMu.Unlock()
+
+	for i, ck := range contextKeys {
+		if ck.name == name {
+			contextKeys[i].key = key
+			return
+		}
+	}
+	contextKeys = append(contextKeys, contextKey{name: name, key: key})
+}
+
+// contextValues returns the values of the registered keys found in ctx
+// as key/value pairs.
+func contextValues(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+
+	contextKeysMu.RLock()
+	defer contextKeysMu.RUnlock()
+
+	var values []interface{}
+	for _, ck := range contextKeys {
+		if v := ctx.Value(ck.key); v != nil {
+			values = append(values, ck.name, v)
+		}
+	}
+	return values
+}
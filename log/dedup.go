@@ -0,0 +1,179 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-stack/stack"
+)
+
+const defaultDedupWindow = 30 * time.Second
+
+// DedupOptions configures a DedupHandler.
+type DedupOptions struct {
+	// Window is the longest time duplicates are collapsed for. After it
+	// has passed since the first suppressed record, the number of
+	// repetitions is reported. Defaults to 30 seconds.
+	Window time.Duration
+
+	// Keys are the context keys compared to decide whether two records
+	// are duplicates, in addition to level and message. If nil, the whole
+	// context is compared; an empty slice compares none of it.
+	Keys []string
+}
+
+// DedupHandler returns a handler which collapses repeated records, like
+// syslog's "last message repeated" does. A record with the same level,
+// message and context as the one before it is not written to h. Instead,
+// once a different record arrives or opts.Window has passed, a record
+// with the message "message repeated N times: MESSAGE" and the count
+// under the key "repeated" is written.
+//
+// Flushing or closing the handler writes a pending count as well.
+func DedupHandler(h Handler, opts DedupOptions) Handler {
+	if opts.Window <= 0 {
+		opts.Window = defaultDedupWindow
+	}
+	return &dedupHandler{h: h, opts: opts}
+}
+
+type dedupHandler struct {
+	h    Handler
+	opts DedupOptions
+
+	mu       sync.Mutex
+	last     string // signature of the last written record
+	since    time.Time
+	repeated int
+	level    LEVEL
+	msg      string
+	call     stack.Call
+	timer    *time.Timer
+	gen      uint64
+}
+
+func (d *dedupHandler) Log(r *Record) error {
+	sig := d.signature(r)
+	now := time.Now()
+
+	d.mu.Lock()
+	if sig == d.last && now.Sub(d.since) < d.opts.Window {
+		if d.repeated == 0 {
+			gen := d.gen
+			d.timer = time.AfterFunc(d.opts.Window-now.Sub(d.since), func() {
+				d.expire(gen)
+			})
+		}
+		d.repeated++
+		d.call = r.Call
+		d.mu.Unlock()
+		return nil
+	}
+
+	summary := d.summary(now)
+	d.last, d.since = sig, now
+	d.level, d.msg = r.Level, r.Message
+	d.mu.Unlock()
+
+	if summary != nil {
+		d.h.Log(summary)
+	}
+	return d.h.Log(r)
+}
+
+func (d *dedupHandler) Flush() error {
+	d.writeSummary()
+	return flushHandler(d.h)
+}
+
+func (d *dedupHandler) Close() error {
+	d.writeSummary()
+	return closeHandler(d.h)
+}
+
+// expire ends the window started in generation gen, unless a different
+// record has ended it already.
+func (d *dedupHandler) expire(gen uint64) {
+	d.mu.Lock()
+	if d.gen != gen {
+		d.mu.Unlock()
+		return
+	}
+	summary := d.summary(time.Now())
+	d.last = ""
+	d.mu.Unlock()
+
+	if summary != nil {
+		d.h.Log(summary)
+	}
+}
+
+func (d *dedupHandler) writeSummary() {
+	d.mu.Lock()
+	summary := d.summary(time.Now())
+	d.mu.Unlock()
+
+	if summary != nil {
+		d.h.Log(summary)
+	}
+}
+
+// summary returns the record reporting the pending repetitions, or nil if
+// there are none, and resets the count. It must be called with d.mu held.
+func (d *dedupHandler) summary(now time.Time) *Record {
+	d.gen++
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.repeated == 0 {
+		return nil
+	}
+
+	n := d.repeated
+	d.repeated = 0
+	d.since = now
+	return &Record{
+		Time:     now,
+		Level:    d.level,
+		Message:  fmt.Sprintf("message repeated %d times: %s", n, d.msg),
+		Context:  []interface{}{"repeated", n},
+		Call:     d.call,
+		KeyNames: defaultKeyNames,
+	}
+}
+
+// signature returns a string identifying the level, message and compared
+// context of r. Values are compared by their printed form, so that
+// records holding maps or slices can be compared too.
+func (d *dedupHandler) signature(r *Record) string {
+	var b strings.Builder
+	b.WriteString(r.Level.String())
+	b.WriteByte(0)
+	b.WriteString(r.Message)
+
+	if d.opts.Keys != nil && len(d.opts.Keys) == 0 {
+		return b.String()
+	}
+
+	ctx := recordContext(r)
+	for i := 0; i+1 < len(ctx); i += 2 {
+		k, _ := ctx[i].(string)
+		if d.opts.Keys != nil && !containsString(d.opts.Keys, k) {
+			continue
+		}
+		fmt.Fprintf(&b, "\x00%v=%+v", ctx[i], ctx[i+1])
+	}
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldType tells which member of a Field holds its value.
+type FieldType uint8
+
+// List of field types
+const (
+	AnyType FieldType = iota
+	StringType
+	Int64Type
+	Uint64Type
+	Float64Type
+	BoolType
+	DurationType
+	TimeType
+	ErrorType
+)
+
+// A Field is a typed key/value pair. Fields of the common types are stored
+// without boxing the value into an interface and are encoded by JsonFormat,
+// LogfmtFormat and TerminalFormatter without reflection.
+//
+// Fields are created with the constructors String, Int, Dur, Err, Time,
+// Any and friends, and logged with Logger.Log or carried by Logger.With.
+type Field struct {
+	Key       string
+	Type      FieldType
+	Integer   int64
+	String    string
+	Interface interface{}
+}
+
+// String returns a Field holding a string.
+func String(key string, val string) Field {
+	return Field{Key: key, Type: StringType, String: val}
+}
+
+// Int returns a Field holding an int.
+func Int(key string, val int) Field {
+	return Field{Key: key, Type: Int64Type, Integer: int64(val)}
+}
+
+// Int64 returns a Field holding an int64.
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Type: Int64Type, Integer: val}
+}
+
+// Uint64 returns a Field holding a uint64.
+func Uint64(key string, val uint64) Field {
+	return Field{Key: key, Type: Uint64Type, Integer: int64(val)}
+}
+
+// Float64 returns a Field holding a float64.
+func Float64(key string, val float64) Field {
+	return Field{Key: key, Type: Float64Type, Integer: int64(math.Float64bits(val))}
+}
+
+// Bool returns a Field holding a bool.
+func Bool(key string, val bool) Field {
+	var i int64
+	if val {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolType, Integer: i}
+}
+
+// Dur returns a Field holding a time.Duration.
+func Dur(key string, val time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Integer: int64(val)}
+}
+
+// Time returns a Field holding a time.Time.
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, Type: TimeType, Integer: val.UnixNano(), Interface: val.Location()}
+}
+
+// Err returns a Field holding an error under the key "error".
+func Err(err error) Field {
+	return Field{Key: "error", Type: ErrorType, Interface: err}
+}
+
+// Any returns a Field holding an arbitrary value. Values of the types
+// supported by the other constructors are stored as if those had been used.
+func Any(key string, val interface{}) Field {
+	switch v := val.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int64:
+		return Int64(key, v)
+	case uint64:
+		return Uint64(key, v)
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Dur(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return Field{Key: key, Type: ErrorType, Interface: v}
+	default:
+		return Field{Key: key, Type: AnyType, Interface: val}
+	}
+}
+
+// Value returns the value of the field as an interface.
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case StringType:
+		return f.String
+	case Int64Type:
+		return f.Integer
+	case Uint64Type:
+		return uint64(f.Integer)
+	case Float64Type:
+		return math.Float64frombits(uint64(f.Integer))
+	case BoolType:
+		return f.Integer == 1
+	case DurationType:
+		return time.Duration(f.Integer)
+	case TimeType:
+		return f.time()
+	default:
+		return f.Interface
+	}
+}
+
+func (f Field) time() time.Time {
+	t := time.Unix(0, f.Integer)
+	if loc, ok := f.Interface.(*time.Location); ok && loc != nil {
+		t = t.In(loc)
+	}
+	return t
+}
+
+// fieldsContext returns fields as key/value pairs, for handlers which only
+// deal with Record.Context.
+func fieldsContext(fields []Field) []interface{} {
+	ctx := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		ctx = append(ctx, f.Key, f.Value())
+	}
+	return ctx
+}
+
+// recordContext returns the context of r followed by its fields, preceded
+// by the logger name if r was logged by a named logger.
+func recordContext(r *Record) []interface{} {
+	ctx := namedContext(r)
+	if len(r.Fields) == 0 {
+		return ctx
+	}
+	return append(ctx[:len(ctx):len(ctx)], fieldsContext(r.Fields)...)
+}
+
+// namedContext returns the context of r, preceded by the logger name if r
+// was logged by a named logger.
+func namedContext(r *Record) []interface{} {
+	if r.Name == "" {
+		return r.Context
+	}
+	ctx := make([]interface{}, 0, len(r.Context)+2)
+	ctx = append(ctx, r.KeyNames.Name, r.Name)
+	return append(ctx, r.Context...)
+}
+
+// appendLogfmtField writes the logfmt encoding of the field value to buf.
+func appendLogfmtField(buf *bytes.Buffer, f Field) {
+	var tmp [64]byte
+	switch f.Type {
+	case StringType:
+		buf.WriteString(escapeString(f.String))
+	case Int64Type:
+		buf.Write(strconv.AppendInt(tmp[:0], f.Integer, 10))
+	case Uint64Type:
+		buf.Write(strconv.AppendUint(tmp[:0], uint64(f.Integer), 10))
+	case Float64Type:
+		buf.Write(strconv.AppendFloat(tmp[:0], math.Float64frombits(uint64(f.Integer)), floatFormat, 3, 64))
+	case BoolType:
+		buf.Write(strconv.AppendBool(tmp[:0], f.Integer == 1))
+	case DurationType:
+		buf.WriteString(time.Duration(f.Integer).String())
+	case TimeType:
+		buf.Write(f.time().AppendFormat(tmp[:0], timeFormat))
+	case ErrorType:
+		if f.Interface == nil {
+			buf.WriteString("nil")
+		} else {
+			buf.WriteString(escapeString(f.Interface.(error).Error()))
+		}
+	default:
+		buf.WriteString(formatLogfmtValue(f.Interface))
+	}
+}
+
+// appendJSONField writes the JSON encoding of the field value to buf.
+func appendJSONField(buf *bytes.Buffer, f Field) {
+	var tmp [64]byte
+	switch f.Type {
+	case StringType:
+		appendJSONString(buf, f.String)
+	case Int64Type:
+		buf.Write(strconv.AppendInt(tmp[:0], f.Integer, 10))
+	case Uint64Type:
+		buf.Write(strconv.AppendUint(tmp[:0], uint64(f.Integer), 10))
+	case Float64Type:
+		v := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			buf.WriteByte('"')
+			buf.Write(strconv.AppendFloat(tmp[:0], v, 'g', -1, 64))
+			buf.WriteByte('"')
+		} else {
+			buf.Write(strconv.AppendFloat(tmp[:0], v, 'g', -1, 64))
+		}
+	case BoolType:
+		buf.Write(strconv.AppendBool(tmp[:0], f.Integer == 1))
+	case DurationType:
+		appendJSONString(buf, time.Duration(f.Integer).String())
+	case TimeType:
+		buf.WriteByte('"')
+		buf.Write(f.time().AppendFormat(tmp[:0], timeFormat))
+		buf.WriteByte('"')
+	case ErrorType:
+		if f.Interface == nil {
+			buf.WriteString("null")
+		} else {
+			appendJSONString(buf, f.Interface.(error).Error())
+		}
+	default:
+		appendJSONValue(buf, f.Interface)
+	}
+}
+
+// appendJSONValue writes the JSON encoding of an arbitrary context value.
+func appendJSONValue(buf *bytes.Buffer, value interface{}) {
+	switch v := formatJSONValue(value).(type) {
+	case string:
+		appendJSONString(buf, v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			appendJSONString(buf, fmt.Sprintf("%+v", v))
+			return
+		}
+		buf.Write(b)
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString writes s as a quoted JSON string, escaping control
+// characters and replacing invalid UTF-8.
+func appendJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != 0x7f {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[c>>4])
+				buf.WriteByte(hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteString(`�`)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
@@ -50,6 +50,12 @@ type TerminalFormatter struct {
 	TimestampFormat string
 	TermMessageJust int
 	CallerLevel     CallerType
+
+	// Sanitize escapes control characters, such as newlines and the ESC of
+	// terminal escape sequences, in messages so that logged data can't
+	// fake records or take over the terminal. Keys and values are always
+	// escaped.
+	Sanitize bool
 }
 
 func TerminalFormatterDefault() TerminalFormatter {
@@ -57,6 +63,7 @@ func TerminalFormatterDefault() TerminalFormatter {
 		TimestampFormat: termTimeFormat,
 		TermMessageJust: termMsgJust,
 		CallerLevel:     CallerTypeNone,
+		Sanitize:        true,
 	}
 }
 
@@ -87,6 +94,11 @@ func (t TerminalFormatter) Format(r *Record) []byte {
 		color = 90
 	}
 
+	msg := r.Message
+	if t.Sanitize {
+		msg = sanitizeString(msg)
+	}
+
 	b := &bytes.Buffer{}
 	lvl := strings.ToUpper(r.Level.String())
 	if color > 0 {
@@ -121,22 +133,22 @@ func (t TerminalFormatter) Format(r *Record) []byte {
 		sb.WriteString("\x1b[0m ")
 
 		if t.CallerLevel == CallerTypeNone {
-			_, _ = fmt.Fprintf(b, sb.String(), color, r.Time.Format(t.TimestampFormat), lvl, r.Message)
+			_, _ = fmt.Fprintf(b, sb.String(), color, r.Time.Format(t.TimestampFormat), lvl, msg)
 		} else {
-			_, _ = fmt.Fprintf(b, sb.String(), color, r.Time.Format(t.TimestampFormat), lvl, r.Call, r.Message)
+			_, _ = fmt.Fprintf(b, sb.String(), color, r.Time.Format(t.TimestampFormat), lvl, r.Call, msg)
 		}
 
 	} else {
-		_, _ = fmt.Fprintf(b, "[%s] [%s] %s ", lvl, r.Time.Format(t.TimestampFormat), r.Message)
+		_, _ = fmt.Fprintf(b, "[%s] [%s] %s ", lvl, r.Time.Format(t.TimestampFormat), msg)
 	}
 
 	// try to justify the log output for short messages
-	if len(r.Context) > 0 && len(r.Message) < t.TermMessageJust {
-		b.Write(bytes.Repeat([]byte{' '}, t.TermMessageJust-len(r.Message)))
+	if (len(r.Context)+len(r.Fields) > 0 || r.Name != "") && len(msg) < t.TermMessageJust {
+		b.Write(bytes.Repeat([]byte{' '}, t.TermMessageJust-len(msg)))
 	}
 
 	// print the keys logfmt style
-	logfmt(b, r.Context, color)
+	logfmt(b, namedContext(r), r.Fields, color)
 	return b.Bytes()
 }
 
@@ -147,14 +159,28 @@ func (t TerminalFormatter) Format(r *Record) []byte {
 //
 func LogfmtFormat() Format {
 	return FormatFunc(func(r *Record) []byte {
-		common := []interface{}{r.KeyNames.Time, r.Time, r.KeyNames.Level, r.Level, r.KeyNames.Message, r.Message}
 		buf := &bytes.Buffer{}
-		logfmt(buf, append(common, r.Context...), 0)
+		buf.WriteString(r.KeyNames.Time)
+		buf.WriteByte('=')
+		buf.WriteString(r.Time.Format(timeFormat))
+		buf.WriteByte(' ')
+		buf.WriteString(r.KeyNames.Level)
+		buf.WriteByte('=')
+		buf.WriteString(r.Level.String())
+		buf.WriteByte(' ')
+		buf.WriteString(r.KeyNames.Message)
+		buf.WriteByte('=')
+		buf.WriteString(escapeString(r.Message))
+		ctx := namedContext(r)
+		if len(ctx)+len(r.Fields) > 0 {
+			buf.WriteByte(' ')
+		}
+		logfmt(buf, ctx, r.Fields, 0)
 		return buf.Bytes()
 	})
 }
 
-func logfmt(buf *bytes.Buffer, ctx []interface{}, color int) {
+func logfmt(buf *bytes.Buffer, ctx []interface{}, fields []Field, color int) {
 	for i := 0; i < len(ctx); i += 2 {
 		if i != 0 {
 			buf.WriteByte(' ')
@@ -163,22 +189,34 @@ func logfmt(buf *bytes.Buffer, ctx []interface{}, color int) {
 		k, ok := ctx[i].(string)
 		v := formatLogfmtValue(ctx[i+1])
 		if !ok {
-			k, v = errorKey, formatLogfmtValue(k)
+			k, v = errorKey, formatLogfmtValue(ctx[i])
 		}
 
-		// XXX: we should probably check that all of your key bytes aren't invalid
-		if color > 0 {
-			fmt.Fprintf(buf, "\x1b[%dm%s\x1b[0m=%s", color, k, v)
-		} else {
-			buf.WriteString(k)
-			buf.WriteByte('=')
-			buf.WriteString(v)
+		logfmtKey(buf, k, color)
+		buf.WriteString(v)
+	}
+
+	for i, f := range fields {
+		if i != 0 || len(ctx) > 0 {
+			buf.WriteByte(' ')
 		}
+		logfmtKey(buf, f.Key, color)
+		appendLogfmtField(buf, f)
 	}
 
 	buf.WriteByte('\n')
 }
 
+func logfmtKey(buf *bytes.Buffer, k string, color int) {
+	k = sanitizeKey(k)
+	if color > 0 {
+		fmt.Fprintf(buf, "\x1b[%dm%s\x1b[0m=", color, k)
+	} else {
+		buf.WriteString(k)
+		buf.WriteByte('=')
+	}
+}
+
 // JsonFormat formats log records as JSON objects separated by newlines.
 // It is the equivalent of JsonFormatEx(false, true).
 func JsonFormat() Format {
@@ -188,6 +226,10 @@ func JsonFormat() Format {
 // JsonFormatEx formats log records as JSON objects. If pretty is true,
 // records will be pretty-printed. If lineSeparated is true, records
 // will be logged with a new line between each record.
+//
+// Context keys which collide with the keys of the time, level, message or
+// logger name get a "fields." prefix. If a key is logged more than once,
+// only its last value is written.
 func JsonFormatEx(pretty, lineSeparated bool) Format {
 	jsonMarshal := json.Marshal
 	if pretty {
@@ -196,19 +238,33 @@ func JsonFormatEx(pretty, lineSeparated bool) Format {
 		}
 	}
 
+	if !pretty {
+		return FormatFunc(func(r *Record) []byte {
+			return jsonRecord(r, lineSeparated)
+		})
+	}
+
 	return FormatFunc(func(r *Record) []byte {
 		props := make(map[string]interface{})
 
 		props[r.KeyNames.Time] = r.Time
 		props[r.KeyNames.Level] = r.Level.String()
 		props[r.KeyNames.Message] = r.Message
+		if r.Name != "" {
+			props[r.KeyNames.Name] = r.Name
+		}
 
-		for i := 0; i < len(r.Context); i += 2 {
-			k, ok := r.Context[i].(string)
-			if !ok {
-				props[errorKey] = fmt.Sprintf("%+v is not a string key", r.Context[i])
+		n := len(r.Context) / 2
+		for i := 0; i < n+len(r.Fields); i++ {
+			k := jsonKey(r, i)
+			switch {
+			case i >= n:
+				props[k] = formatJSONValue(r.Fields[i-n].Value())
+			case k == errorKey:
+				props[k] = fmt.Sprintf("%+v is not a string key", r.Context[2*i])
+			default:
+				props[k] = formatJSONValue(r.Context[2*i+1])
 			}
-			props[k] = formatJSONValue(r.Context[i+1])
 		}
 
 		b, err := jsonMarshal(props)
@@ -227,6 +283,95 @@ func JsonFormatEx(pretty, lineSeparated bool) Format {
 	})
 }
 
+// jsonRecord encodes r as a single line JSON object, writing the keys in
+// the order they were logged. Typed fields are encoded without reflection.
+func jsonRecord(r *Record, lineSeparated bool) []byte {
+	buf := &bytes.Buffer{}
+	var tmp [64]byte
+
+	buf.WriteByte('{')
+	appendJSONString(buf, r.KeyNames.Time)
+	buf.WriteString(`:"`)
+	buf.Write(r.Time.AppendFormat(tmp[:0], time.RFC3339Nano))
+	buf.WriteString(`",`)
+	appendJSONString(buf, r.KeyNames.Level)
+	buf.WriteByte(':')
+	appendJSONString(buf, r.Level.String())
+	buf.WriteByte(',')
+	appendJSONString(buf, r.KeyNames.Message)
+	buf.WriteByte(':')
+	appendJSONString(buf, r.Message)
+	if r.Name != "" {
+		buf.WriteByte(',')
+		appendJSONString(buf, r.KeyNames.Name)
+		buf.WriteByte(':')
+		appendJSONString(buf, r.Name)
+	}
+
+	n := len(r.Context) / 2
+	for i := 0; i < n+len(r.Fields); i++ {
+		k := jsonKey(r, i)
+		if jsonKeyRepeated(r, i, k) {
+			continue
+		}
+		buf.WriteByte(',')
+		appendJSONString(buf, k)
+		buf.WriteByte(':')
+		switch {
+		case i >= n:
+			appendJSONField(buf, r.Fields[i-n])
+		case k == errorKey:
+			appendJSONString(buf, fmt.Sprintf("%+v is not a string key", r.Context[2*i]))
+		default:
+			appendJSONValue(buf, r.Context[2*i+1])
+		}
+	}
+
+	buf.WriteByte('}')
+	if lineSeparated {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// jsonKey returns the key under which the JSON formats write the i-th
+// context pair of r or, counting on after those, field of r. Keys which
+// collide with the time, level, message or logger name of the record get a
+// "fields." prefix, and keys which are not strings become errorKey.
+func jsonKey(r *Record, i int) string {
+	var k string
+	if n := len(r.Context) / 2; i < n {
+		var ok bool
+		if k, ok = r.Context[2*i].(string); !ok {
+			return errorKey
+		}
+	} else {
+		k = r.Fields[i-n].Key
+	}
+
+	switch k {
+	case r.KeyNames.Time, r.KeyNames.Level, r.KeyNames.Message:
+		return "fields." + k
+	case r.KeyNames.Name:
+		if r.Name != "" {
+			return "fields." + k
+		}
+	}
+	return k
+}
+
+// jsonKeyRepeated reports whether the key k of the i-th context pair or
+// field of r is written again later, in which case only the last value is
+// kept, as a JSON object can hold a key only once.
+func jsonKeyRepeated(r *Record, i int, k string) bool {
+	for j := i + 1; j < len(r.Context)/2+len(r.Fields); j++ {
+		if jsonKey(r, j) == k {
+			return true
+		}
+	}
+	return false
+}
+
 func formatShared(value interface{}) (result interface{}) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -306,7 +451,7 @@ func escapeString(s string) string {
 		if r <= ' ' || r == '=' || r == '"' {
 			needsQuotes = true
 		}
-		if r == '\\' || r == '"' || r == '\n' || r == '\r' || r == '\t' {
+		if r == '\\' || r == '"' || isControl(r) {
 			needsEscape = true
 		}
 	}
@@ -316,16 +461,12 @@ func escapeString(s string) string {
 	e := stringBufPool.Get().(*bytes.Buffer)
 	e.WriteByte('"')
 	for _, r := range s {
-		switch r {
-		case '\\', '"':
+		switch {
+		case r == '\\' || r == '"':
 			e.WriteByte('\\')
 			e.WriteByte(byte(r))
-		case '\n':
-			e.WriteString("\\n")
-		case '\r':
-			e.WriteString("\\r")
-		case '\t':
-			e.WriteString("\\t")
+		case isControl(r):
+			writeEscapedRune(e, r)
 		default:
 			e.WriteRune(r)
 		}
@@ -341,3 +482,78 @@ func escapeString(s string) string {
 	stringBufPool.Put(e)
 	return ret
 }
+
+// sanitizeString escapes the control characters in s, leaving everything
+// else as is.
+func sanitizeString(s string) string {
+	clean := true
+	for _, r := range s {
+		if isControl(r) {
+			clean = false
+			break
+		}
+	}
+	if clean {
+		return s
+	}
+
+	e := stringBufPool.Get().(*bytes.Buffer)
+	for _, r := range s {
+		if isControl(r) {
+			writeEscapedRune(e, r)
+		} else {
+			e.WriteRune(r)
+		}
+	}
+	ret := e.String()
+	e.Reset()
+	stringBufPool.Put(e)
+	return ret
+}
+
+// sanitizeKey makes k safe to print as a logfmt key: control characters
+// are escaped and spaces, '=' and '"' are replaced by '_'.
+func sanitizeKey(k string) string {
+	k = sanitizeString(k)
+	if !strings.ContainsAny(k, " =\"") {
+		return k
+	}
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+// isControl reports whether r is a C0 or C1 control character, DEL or a
+// Unicode bidirectional override, all of which can change how the text
+// following them is displayed.
+func isControl(r rune) bool {
+	switch {
+	case r < 0x20, r == 0x7f:
+		return true
+	case r >= 0x80 && r <= 0x9f:
+		return true
+	case r >= 0x202a && r <= 0x202e, r >= 0x2066 && r <= 0x2069:
+		return true
+	}
+	return false
+}
+
+func writeEscapedRune(e *bytes.Buffer, r rune) {
+	switch r {
+	case '\n':
+		e.WriteString("\\n")
+	case '\r':
+		e.WriteString("\\r")
+	case '\t':
+		e.WriteString("\\t")
+	default:
+		if r < 0x80 {
+			fmt.Fprintf(e, "\\x%02x", r)
+		} else {
+			fmt.Fprintf(e, "\\u%04x", r)
+		}
+	}
+}
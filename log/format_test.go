@@ -0,0 +1,146 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var benchTime = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+// benchRecords returns the same record once with typed fields and once
+// with an []interface{} context.
+func benchRecords() []struct {
+	name string
+	r    *Record
+} {
+	err := errors.New("connection reset")
+	return []struct {
+		name string
+		r    *Record
+	}{{
+		"Fields", &Record{
+			Time:    benchTime,
+			Level:   LevelInfo,
+			Message: "request handled",
+			Context: []interface{}{},
+			Fields: []Field{
+				String("method", "GET"),
+				String("path", "/api/v1/users"),
+				Int("status", 200),
+				Dur("elapsed", 1500*time.Microsecond),
+				Time("started", benchTime),
+				Err(err),
+			},
+			KeyNames: defaultKeyNames,
+		},
+	}, {
+		"Context", &Record{
+			Time:    benchTime,
+			Level:   LevelInfo,
+			Message: "request handled",
+			Context: []interface{}{
+				"method", "GET",
+				"path", "/api/v1/users",
+				"status", 200,
+				"elapsed", 1500 * time.Microsecond,
+				"started", benchTime,
+				"error", err,
+			},
+			KeyNames: defaultKeyNames,
+		},
+	}}
+}
+
+func benchmarkFormat(b *testing.B, fmtr Format) {
+	for _, bench := range benchRecords() {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fmtr.Format(bench.r)
+			}
+		})
+	}
+}
+
+func BenchmarkJsonFormat(b *testing.B) {
+	benchmarkFormat(b, JsonFormat())
+}
+
+func BenchmarkLogfmtFormat(b *testing.B) {
+	benchmarkFormat(b, LogfmtFormat())
+}
+
+func BenchmarkTerminalFormatter(b *testing.B) {
+	benchmarkFormat(b, TerminalFormatterDefault())
+}
+
+// fuzzFormat checks that messages, keys, values and logger names can't
+// inject control characters, such as ESC or newlines, into the output of
+// fmtr. Only a newline at the end of a record and the ESC bytes the
+// formatter writes itself, as many as for harmless input, are allowed.
+func fuzzFormat(f *testing.F, fmtr Format, isJSON bool) {
+	for _, seed := range []string{
+		"hello",
+		"hello\nlvl=crit msg=forged",
+		"\x1b[31mred\x1b[0m",
+		"\r\x00\x7f\x1b]0;title\x07",
+		"key=\"value\" \u202egnp.exe",
+		"\xff\xfe",
+	} {
+		f.Add(seed, seed, seed)
+	}
+	f.Add("0", "", "0")
+
+	record := func(msg, key, value string) *Record {
+		return &Record{
+			Time:     benchTime,
+			Level:    LevelInfo,
+			Message:  msg,
+			Context:  []interface{}{key, value},
+			Fields:   []Field{String(key, value)},
+			KeyNames: defaultKeyNames,
+			Name:     key,
+		}
+	}
+	// an empty key leaves out the logger name, and the colour codes
+	// around it, so count them for both shapes of record
+	escapes := make(map[bool]int)
+	for _, key := range []string{"k", ""} {
+		escapes[key == ""] = bytes.Count(fmtr.Format(record("m", key, "v")), []byte{0x1b})
+	}
+
+	f.Fuzz(func(t *testing.T, msg, key, value string) {
+		out := fmtr.Format(record(msg, key, value))
+		if n, want := bytes.Count(out, []byte{0x1b}), escapes[key == ""]; n != want {
+			t.Fatalf("output has %d ESC bytes, want %d: %q", n, want, out)
+		}
+		body := bytes.TrimSuffix(out, []byte{'\n'})
+		for _, c := range body {
+			if (c < 0x20 && c != 0x1b) || c == 0x7f {
+				t.Fatalf("output has control character %#x: %q", c, out)
+			}
+		}
+		if isJSON && !json.Valid(body) {
+			t.Fatalf("output is not valid JSON: %q", out)
+		}
+	})
+}
+
+func FuzzTerminalFormatter(f *testing.F) {
+	fuzzFormat(f, TerminalFormatterDefault(), false)
+}
+
+func FuzzLogfmtFormat(f *testing.F) {
+	fuzzFormat(f, LogfmtFormat(), false)
+}
+
+func FuzzJsonFormat(f *testing.F) {
+	fuzzFormat(f, JsonFormat(), true)
+}
+
+func FuzzGELFFormat(f *testing.F) {
+	fuzzFormat(f, GELFFormat(), true)
+}
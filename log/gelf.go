@@ -0,0 +1,217 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGELFChunkSize = 1420
+	gelfChunkHeaderSize  = 12
+	gelfMaxChunks        = 128
+)
+
+// GELFFormat returns a Format which formats log records as GELF 1.1 JSON
+// messages, as accepted by Graylog. The first line of the message is sent
+// as short_message and, if there are more, the whole message as
+// full_message. The level is sent as a syslog severity and the context,
+// including the logger name, as additional fields, prefixed with an
+// underscore. Numbers are sent as numbers, any other value as a string.
+func GELFFormat() Format {
+	host, _ := os.Hostname()
+	return FormatFunc(func(r *Record) []byte {
+		return gelfMessage(r, host)
+	})
+}
+
+func gelfMessage(r *Record, host string) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"version":"1.1","host":`)
+	appendJSONString(buf, syslogField(host, "localhost"))
+
+	short, _, multiline := strings.Cut(r.Message, "\n")
+	if short == "" {
+		// Graylog rejects messages without a short_message
+		short = "-"
+	}
+	buf.WriteString(`,"short_message":`)
+	appendJSONString(buf, short)
+	if multiline {
+		buf.WriteString(`,"full_message":`)
+		appendJSONString(buf, r.Message)
+	}
+	buf.WriteString(`,"timestamp":`)
+	buf.WriteString(strconv.FormatFloat(float64(r.Time.UnixNano())/1e9, 'f', 3, 64))
+	buf.WriteString(`,"level":`)
+	buf.WriteString(strconv.Itoa(syslogSeverity(r.Level)))
+
+	ctx := recordContext(r)
+	for i := 0; i < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		v := ctx[i+1]
+		if !ok {
+			k, v = errorKey, fmt.Sprintf("%+v is not a string key", ctx[i])
+		}
+		buf.WriteByte(',')
+		appendJSONString(buf, gelfFieldName(k))
+		buf.WriteByte(':')
+		switch v := formatShared(v).(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			fmt.Fprint(buf, v)
+		case float32, float64:
+			appendJSONValue(buf, v)
+		case string:
+			appendJSONString(buf, v)
+		default:
+			appendJSONString(buf, fmt.Sprintf("%+v", v))
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// gelfFieldName turns a context key into the name of an additional field:
+// an underscore followed by letters, digits, underscores, dots and dashes.
+// "_id" is reserved by Graylog and sent as "__id".
+func gelfFieldName(k string) string {
+	name := []byte("_" + k)
+	for i, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' && c != '.' && c != '-' {
+			name[i] = '_'
+		}
+	}
+	if string(name) == "_id" {
+		return "__id"
+	}
+	return string(name)
+}
+
+// GELFCompression selects the compression of GELF messages sent over UDP.
+type GELFCompression int
+
+// List of GELF compression methods
+const (
+	GELFCompressNone GELFCompression = iota
+	GELFCompressGzip
+	GELFCompressZlib
+)
+
+// GELFOptions configures a GELFHandler.
+type GELFOptions struct {
+	// Compression compresses messages sent over UDP. GELF over TCP
+	// doesn't support compression. Messages are not compressed by
+	// default.
+	Compression GELFCompression
+
+	// ChunkSize is the size of the largest UDP datagram sent. Larger
+	// messages are split into up to 128 chunks. Defaults to 1420 bytes,
+	// which fits into the MTU of most networks.
+	ChunkSize int
+
+	// Net configures the connection for TCP, see NetHandlerEx.
+	Net NetOptions
+}
+
+// GELFHandler returns a handler which sends log records formatted with
+// GELFFormat to a Graylog input at addr on the given network, "udp" or
+// "tcp". Over UDP, messages larger than opts.ChunkSize are chunked. Over
+// TCP, messages are terminated by a zero byte and written by a NetHandler,
+// which reconnects and buffers records while the connection is down.
+func GELFHandler(network, addr string, opts GELFOptions) (Handler, error) {
+	if opts.ChunkSize <= gelfChunkHeaderSize {
+		opts.ChunkSize = defaultGELFChunkSize
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		if opts.Compression != GELFCompressNone {
+			return nil, fmt.Errorf("log: GELF over %s doesn't support compression", network)
+		}
+		fmtr := GELFFormat()
+		return NetHandlerEx(network, addr, FormatFunc(func(r *Record) []byte {
+			return append(fmtr.Format(r), 0)
+		}), opts.Net), nil
+	case "udp", "udp4", "udp6":
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		host, _ := os.Hostname()
+		return LazyHandler(&gelfHandler{conn: conn, host: host, opts: opts}), nil
+	default:
+		return nil, fmt.Errorf("log: unsupported GELF network %q", network)
+	}
+}
+
+type gelfHandler struct {
+	conn net.Conn
+	host string
+	opts GELFOptions
+}
+
+func (h *gelfHandler) Log(r *Record) error {
+	msg, err := h.compress(gelfMessage(r, h.host))
+	if err != nil {
+		return err
+	}
+	if len(msg) <= h.opts.ChunkSize {
+		_, err := h.conn.Write(msg)
+		return err
+	}
+
+	size := h.opts.ChunkSize - gelfChunkHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > gelfMaxChunks {
+		return fmt.Errorf("log: GELF message of %d bytes needs %d chunks, at most %d are allowed", len(msg), count, gelfMaxChunks)
+	}
+
+	// every chunk starts with the magic bytes, the message ID, its
+	// sequence number and the number of chunks
+	id := rand.Uint64()
+	chunk := make([]byte, 0, h.opts.ChunkSize)
+	for i := 0; i < count; i++ {
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = binary.BigEndian.AppendUint64(chunk, id)
+		chunk = append(chunk, byte(i), byte(count))
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk = append(chunk, msg[i*size:end]...)
+		if _, err := h.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *gelfHandler) Close() error {
+	return h.conn.Close()
+}
+
+func (h *gelfHandler) compress(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch h.opts.Compression {
+	case GELFCompressGzip:
+		zw = gzip.NewWriter(&buf)
+	case GELFCompressZlib:
+		zw = zlib.NewWriter(&buf)
+	default:
+		return msg, nil
+	}
+	zw.Write(msg)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,226 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gelfListener listens for UDP datagrams on a local port.
+func gelfListener(t *testing.T) net.PacketConn {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return pc
+}
+
+func readDatagram(t *testing.T, pc net.PacketConn) []byte {
+	t.Helper()
+	buf := make([]byte, 65536)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+// readChunks reads the chunks of a message and reassembles it.
+func readChunks(t *testing.T, pc net.PacketConn, chunkSize int) []byte {
+	t.Helper()
+	var id uint64
+	var chunks [][]byte
+	for n := 0; n == 0 || n < len(chunks); n++ {
+		chunk := readDatagram(t, pc)
+		if len(chunk) > chunkSize {
+			t.Fatalf("chunk of %d bytes, want at most %d", len(chunk), chunkSize)
+		}
+		if len(chunk) <= gelfChunkHeaderSize || chunk[0] != 0x1e || chunk[1] != 0x0f {
+			t.Fatalf("not a chunk: %q", chunk)
+		}
+		seq, count := int(chunk[10]), int(chunk[11])
+		if n == 0 {
+			id = binary.BigEndian.Uint64(chunk[2:])
+			chunks = make([][]byte, count)
+		} else if binary.BigEndian.Uint64(chunk[2:]) != id || count != len(chunks) {
+			t.Fatalf("chunk %d/%d doesn't belong to message %x of %d chunks", seq, count, id, len(chunks))
+		}
+		if seq >= count || chunks[seq] != nil {
+			t.Fatalf("bad sequence number %d of %d", seq, count)
+		}
+		chunks[seq] = chunk[gelfChunkHeaderSize:]
+	}
+	return bytes.Join(chunks, nil)
+}
+
+func decodeGELF(t *testing.T, b []byte) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("%v: %q", err, b)
+	}
+	return m
+}
+
+func newTestGELFHandler(t *testing.T, network, addr string, opts GELFOptions) Handler {
+	t.Helper()
+	h, err := GELFHandler(network, addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeHandler(h) })
+	return h
+}
+
+func TestGELFHandlerUDP(t *testing.T) {
+	pc := gelfListener(t)
+	h := newTestGELFHandler(t, "udp", pc.LocalAddr().String(), GELFOptions{})
+
+	r := testRecord("hello\nworld", "id", "abc", "n", 42)
+	r.Level = LevelError
+	if err := h.Log(r); err != nil {
+		t.Fatal(err)
+	}
+
+	m := decodeGELF(t, readDatagram(t, pc))
+	for k, want := range map[string]interface{}{
+		"version":       "1.1",
+		"short_message": "hello",
+		"full_message":  "hello\nworld",
+		"level":         float64(3),
+		"timestamp":     float64(benchTime.Unix()),
+		"__id":          "abc",
+		"_n":            float64(42),
+	} {
+		if m[k] != want {
+			t.Errorf("%s = %#v, want %#v", k, m[k], want)
+		}
+	}
+	if m["host"] == "" {
+		t.Error("host is not set")
+	}
+}
+
+func TestGELFHandlerCompression(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		compression GELFCompression
+		reader      func(io.Reader) (io.ReadCloser, error)
+	}{
+		{"Gzip", GELFCompressGzip, func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }},
+		{"Zlib", GELFCompressZlib, zlib.NewReader},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pc := gelfListener(t)
+			h := newTestGELFHandler(t, "udp", pc.LocalAddr().String(), GELFOptions{
+				Compression: test.compression,
+			})
+			if err := h.Log(testRecord("compressed")); err != nil {
+				t.Fatal(err)
+			}
+
+			zr, err := test.reader(bytes.NewReader(readDatagram(t, pc)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m := decodeGELF(t, b); m["short_message"] != "compressed" {
+				t.Errorf("short_message = %#v", m["short_message"])
+			}
+		})
+	}
+}
+
+func TestGELFHandlerChunking(t *testing.T) {
+	const chunkSize = 200
+	msg := strings.Repeat("0123456789", 100)
+
+	t.Run("None", func(t *testing.T) {
+		pc := gelfListener(t)
+		h := newTestGELFHandler(t, "udp", pc.LocalAddr().String(), GELFOptions{ChunkSize: chunkSize})
+		for i := 0; i < 2; i++ {
+			if err := h.Log(testRecord(msg)); err != nil {
+				t.Fatal(err)
+			}
+			if m := decodeGELF(t, readChunks(t, pc, chunkSize)); m["short_message"] != msg {
+				t.Errorf("short_message = %#v", m["short_message"])
+			}
+		}
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		// compressed messages are chunked as well
+		pc := gelfListener(t)
+		h := newTestGELFHandler(t, "udp", pc.LocalAddr().String(), GELFOptions{
+			Compression: GELFCompressGzip,
+			ChunkSize:   gelfChunkHeaderSize + 16,
+		})
+		if err := h.Log(testRecord(msg)); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(readChunks(t, pc, gelfChunkHeaderSize+16)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := decodeGELF(t, b); m["short_message"] != msg {
+			t.Errorf("short_message = %#v", m["short_message"])
+		}
+	})
+
+	t.Run("TooManyChunks", func(t *testing.T) {
+		pc := gelfListener(t)
+		h := newTestGELFHandler(t, "udp", pc.LocalAddr().String(), GELFOptions{
+			ChunkSize: gelfChunkHeaderSize + 1,
+		})
+		if err := h.Log(testRecord(msg)); err == nil {
+			t.Error("no error for a message which needs more than 128 chunks")
+		}
+	})
+}
+
+func TestGELFHandlerTCP(t *testing.T) {
+	ln, conns := tcpListener(t)
+	h := newTestGELFHandler(t, "tcp", ln.Addr().String(), GELFOptions{})
+
+	msgs := []string{"first", "second\nline"}
+	for _, msg := range msgs {
+		if err := h.Log(testRecord(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := bufio.NewReader(accept(t, conns))
+	for _, msg := range msgs {
+		b, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := decodeGELF(t, bytes.TrimSuffix(b, []byte{0}))
+		short, _, multiline := strings.Cut(msg, "\n")
+		if m["short_message"] != short || (multiline && m["full_message"] != msg) {
+			t.Errorf("got %v for %q", m, msg)
+		}
+	}
+
+	if _, err := GELFHandler("tcp", ln.Addr().String(), GELFOptions{Compression: GELFCompressGzip}); err == nil {
+		t.Error("no error for compression over TCP")
+	}
+}
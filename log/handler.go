@@ -29,14 +29,49 @@ func (h *swapHandler) Get() Handler {
 	return *h.handler.Load().(*Handler)
 }
 
+func (h *swapHandler) Flush() error {
+	return flushHandler(h.Get())
+}
+
+func (h *swapHandler) Close() error {
+	return closeHandler(h.Get())
+}
+
 // Handler interface defines where and how log records are written.
 // A logger prints its log records by writing to a Handler.
 // Handlers are composable, providing you great flexibility in combining
 // them to achieve the logging structure that suits your applications.
+//
+// A Handler that buffers records or owns a resource may additionally
+// implement Flusher and io.Closer. The handlers in this package that
+// wrap other handlers forward Flush and Close to them, so flushing or
+// closing the outermost handler reaches the whole tree.
 type Handler interface {
 	Log(r *Record) error
 }
 
+// Flusher is implemented by handlers that buffer records and can
+// write them out on request.
+type Flusher interface {
+	Flush() error
+}
+
+// flushHandler flushes h if it implements Flusher.
+func flushHandler(h Handler) error {
+	if f, ok := h.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// closeHandler closes h if it implements io.Closer.
+func closeHandler(h Handler) error {
+	if c, ok := h.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 // FuncHandler returns a Handler that logs records with the given
 // function.
 func FuncHandler(fn func(r *Record) error) Handler {
@@ -56,48 +91,229 @@ func (h funcHandler) Log(r *Record) error {
 //
 // StreamHandler wraps itself with LazyHandler and SyncHandler
 // to evaluate Lazy objects and perform safe concurrent writes.
+// If wr implements Flusher, flushing the handler flushes wr.
+// The writer is never closed by the handler.
 func StreamHandler(wr io.Writer, fmtr Format) Handler {
-	h := FuncHandler(func(r *Record) error {
-		_, err := wr.Write(fmtr.Format(r))
-		return err
-	})
-	return LazyHandler(SyncHandler(h))
+	return LazyHandler(SyncHandler(&streamHandler{wr: wr, fmtr: fmtr}))
+}
+
+type streamHandler struct {
+	wr   io.Writer
+	fmtr Format
+}
+
+func (h *streamHandler) Log(r *Record) error {
+	_, err := h.wr.Write(h.fmtr.Format(r))
+	return err
+}
+
+func (h *streamHandler) Flush() error {
+	if f, ok := h.wr.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
 }
 
 // SyncHandler can be wrapped around a handler to guarantee that
 // only a single Log operation can proceed at a time. It's necessary
 // for thread-safe concurrent writes.
 func SyncHandler(h Handler) Handler {
-	var mu sync.Mutex
-	return FuncHandler(func(r *Record) error {
-		defer mu.Unlock()
-		mu.Lock()
-		return h.Log(r)
-	})
+	return &syncHandler{h: h}
+}
+
+type syncHandler struct {
+	mu sync.Mutex
+	h  Handler
+}
+
+func (h *syncHandler) Log(r *Record) error {
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	return h.h.Log(r)
+}
+
+func (h *syncHandler) Flush() error {
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	return flushHandler(h.h)
+}
+
+func (h *syncHandler) Close() error {
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	return closeHandler(h.h)
 }
 
 // FileHandler returns a handler which writes log records to the give file
 // using the given format. If the path
 // already exists, FileHandler will append to the given file. If it does not,
 // FileHandler will create the file with mode 0644.
+//
+// Flushing the handler syncs the file to disk and closing it closes the file.
 func FileHandler(path string, fmtr Format) (Handler, error) {
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
-	return closingHandler{f, StreamHandler(f, fmtr)}, nil
+	return &closingHandler{f, StreamHandler(f, fmtr)}, nil
 }
 
-// XXX: closingHandler is essentially unused at the moment
-// it's meant for a future time when the Handler interface supports
-// a possible Close() operation
+// closingHandler writes to a handler which owns the underlying
+// WriteCloser and closes it together with the handler.
 type closingHandler struct {
 	io.WriteCloser
 	Handler
 }
 
+func (h *closingHandler) Flush() error {
+	if err := flushHandler(h.Handler); err != nil {
+		return err
+	}
+	if s, ok := h.WriteCloser.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
 func (h *closingHandler) Close() error {
-	return h.WriteCloser.Close()
+	err := h.Flush()
+	if cerr := closeHandler(h.Handler); err == nil {
+		err = cerr
+	}
+	if cerr := h.WriteCloser.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// FilterHandler returns a Handler that only writes records to the
+// wrapped Handler if the given function evaluates true. For example,
+// to only log records where the 'err' key is not nil:
+//
+//     logger.SetHandler(log.FilterHandler(func(r *log.Record) bool {
+//         for i := 0; i < len(r.Context); i += 2 {
+//             if r.Context[i] == "err" {
+//                 return r.Context[i+1] != nil
+//             }
+//         }
+//         return false
+//     }, h))
+//
+func FilterHandler(fn func(r *Record) bool, h Handler) Handler {
+	return &filterHandler{fn: fn, h: h}
+}
+
+type filterHandler struct {
+	fn func(r *Record) bool
+	h  Handler
+}
+
+func (h *filterHandler) Log(r *Record) error {
+	if h.fn(r) {
+		return h.h.Log(r)
+	}
+	return nil
+}
+
+func (h *filterHandler) Flush() error {
+	return flushHandler(h.h)
+}
+
+func (h *filterHandler) Close() error {
+	return closeHandler(h.h)
+}
+
+// MatchFilterHandler returns a Handler that only writes records
+// to the wrapped Handler if the given key in the logged
+// context matches the value. For example, to only log records
+// from your ui package:
+//
+//     log.MatchFilterHandler("pkg", "app/ui", log.StdoutHandler)
+//
+// Integers match regardless of their type, so a value of 200 matches
+// both "status", 200 in the context and the field Int("status", 200).
+func MatchFilterHandler(key string, value interface{}, h Handler) Handler {
+	return FilterHandler(func(r *Record) (pass bool) {
+		switch key {
+		case r.KeyNames.Level:
+			return r.Level == value
+		case r.KeyNames.Time:
+			return r.Time == value
+		case r.KeyNames.Message:
+			return r.Message == value
+		case r.KeyNames.Name:
+			return r.Name == value
+		}
+
+		for i := 0; i < len(r.Context); i += 2 {
+			if r.Context[i] == key {
+				return matchValue(r.Context[i+1], value)
+			}
+		}
+		for _, f := range r.Fields {
+			if f.Key == key {
+				return matchValue(f.Value(), value)
+			}
+		}
+		return false
+	}, h)
+}
+
+// matchValue reports whether v equals value. Integers of different types
+// are equal if their values are.
+func matchValue(v, value interface{}) bool {
+	if v == value {
+		return true
+	}
+	a, aneg, aok := integerValue(v)
+	b, bneg, bok := integerValue(value)
+	return aok && bok && a == b && aneg == bneg
+}
+
+// integerValue returns the magnitude and sign of v if it is one of the
+// built-in integer types.
+func integerValue(v interface{}) (n uint64, neg, ok bool) {
+	var i int64
+	switch v := v.(type) {
+	case int:
+		i = int64(v)
+	case int8:
+		i = int64(v)
+	case int16:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint:
+		return uint64(v), false, true
+	case uint8:
+		return uint64(v), false, true
+	case uint16:
+		return uint64(v), false, true
+	case uint32:
+		return uint64(v), false, true
+	case uint64:
+		return v, false, true
+	default:
+		return 0, false, false
+	}
+	if i < 0 {
+		return uint64(-i), true, true
+	}
+	return uint64(i), false, true
+}
+
+// LvlFilterHandler returns a Handler that only writes
+// records which are at maxLvl or less verbose to the wrapped
+// Handler. For example, to only log Warning/Error/Fatal records:
+//
+//     log.LvlFilterHandler(log.LevelWarning, log.StdoutHandler)
+//
+func LvlFilterHandler(maxLvl LEVEL, h Handler) Handler {
+	return FilterHandler(func(r *Record) (pass bool) {
+		return r.Level >= maxLvl
+	}, h)
 }
 
 // MultiHandler dispatches any write to each of its handlers.
@@ -109,14 +325,40 @@ func (h *closingHandler) Close() error {
 //         log.Must.FileHandler("/var/log/app.log", log.LogfmtFormat()),
 //         log.StderrHandler)
 //
+// Flush and Close are forwarded to every handler; the first error
+// encountered is returned.
 func MultiHandler(hs ...Handler) Handler {
-	return FuncHandler(func(r *Record) error {
-		for _, h := range hs {
-			// what to do about failures?
-			h.Log(r)
+	return multiHandler(hs)
+}
+
+type multiHandler []Handler
+
+func (hs multiHandler) Log(r *Record) error {
+	for _, h := range hs {
+		// what to do about failures?
+		h.Log(r)
+	}
+	return nil
+}
+
+func (hs multiHandler) Flush() error {
+	var err error
+	for _, h := range hs {
+		if ferr := flushHandler(h); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+func (hs multiHandler) Close() error {
+	var err error
+	for _, h := range hs {
+		if cerr := closeHandler(h); err == nil {
+			err = cerr
 		}
-		return nil
-	})
+	}
+	return err
 }
 
 // LazyHandler writes all values to the wrapped handler after evaluating
@@ -124,32 +366,46 @@ func MultiHandler(hs ...Handler) Handler {
 // around StreamHandler and SyslogHandler in this library, you'll only need
 // it if you write your own Handler.
 func LazyHandler(h Handler) Handler {
-	return FuncHandler(func(r *Record) error {
-		// go through the values (odd indices) and reassign
-		// the values of any lazy fn to the result of its execution
-		hadErr := false
-		for i := 1; i < len(r.Context); i += 2 {
-			lz, ok := r.Context[i].(Lazy)
-			if ok {
-				v, err := evaluateLazy(lz)
-				if err != nil {
-					hadErr = true
-					r.Context[i] = err
-				} else {
-					if cs, ok := v.(stack.CallStack); ok {
-						v = cs.TrimBelow(r.Call).TrimRuntime()
-					}
-					r.Context[i] = v
+	return &lazyHandler{h: h}
+}
+
+type lazyHandler struct {
+	h Handler
+}
+
+func (h *lazyHandler) Log(r *Record) error {
+	// go through the values (odd indices) and reassign
+	// the values of any lazy fn to the result of its execution
+	hadErr := false
+	for i := 1; i < len(r.Context); i += 2 {
+		lz, ok := r.Context[i].(Lazy)
+		if ok {
+			v, err := evaluateLazy(lz)
+			if err != nil {
+				hadErr = true
+				r.Context[i] = err
+			} else {
+				if cs, ok := v.(stack.CallStack); ok {
+					v = cs.TrimBelow(r.Call).TrimRuntime()
 				}
+				r.Context[i] = v
 			}
 		}
+	}
 
-		if hadErr {
-			r.Context = append(r.Context, errorKey, "bad lazy")
-		}
+	if hadErr {
+		r.Context = append(r.Context, errorKey, "bad lazy")
+	}
+
+	return h.h.Log(r)
+}
+
+func (h *lazyHandler) Flush() error {
+	return flushHandler(h.h)
+}
 
-		return h.Log(r)
-	})
+func (h *lazyHandler) Close() error {
+	return closeHandler(h.h)
 }
 
 func evaluateLazy(lz Lazy) (interface{}, error) {
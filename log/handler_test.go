@@ -0,0 +1,34 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchFilterHandler(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		value interface{}
+		r     *Record
+		match bool
+	}{
+		{"ContextInt", 200, testRecord("m", "status", 200), true},
+		{"FieldInt", 200, &Record{Fields: []Field{Int("status", 200)}}, true},
+		{"FieldInt64", int64(200), &Record{Fields: []Field{Int("status", 200)}}, true},
+		{"FieldUint64", 200, &Record{Fields: []Field{Uint64("status", 200)}}, true},
+		{"ContextUint8", int64(200), testRecord("m", "status", uint8(200)), true},
+		{"OtherInt", 404, &Record{Fields: []Field{Int("status", 200)}}, false},
+		{"Negative", -1, &Record{Fields: []Field{Uint64("status", 1)}}, false},
+		{"String", "200", &Record{Fields: []Field{Int("status", 200)}}, false},
+		{"FieldString", "ok", &Record{Fields: []Field{String("status", "ok")}}, true},
+		{"Duration", 200, &Record{Fields: []Field{Dur("status", 200 * time.Nanosecond)}}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := &recorder{}
+			MatchFilterHandler("status", test.value, h).Log(test.r)
+			if matched := len(h.records) == 1; matched != test.match {
+				t.Errorf("matched %v, want %v", matched, test.match)
+			}
+		})
+	}
+}
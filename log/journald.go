@@ -0,0 +1,120 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalHandlerFields are the fields written by the handler itself.
+var journalHandlerFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// JournalOptions configures a JournalHandler.
+type JournalOptions struct {
+	// Path is the journald socket, "/run/systemd/journal/socket" by
+	// default.
+	Path string
+
+	// SyslogIdentifier is sent in the SYSLOG_IDENTIFIER field, the base
+	// name of os.Args[0] by default.
+	SyslogIdentifier string
+}
+
+// JournalHandler opens the journald socket and returns a handler which
+// writes log records to it using the journald native protocol. The message
+// is sent as MESSAGE, the level as PRIORITY, the call site as CODE_FILE,
+// CODE_LINE and CODE_FUNC, and every context key, including the logger
+// name, as a field of its own: uppercased, with characters journald
+// doesn't accept in field names replaced by underscores. Keys which would
+// clash with the fields written by the handler are prefixed with "KEY_",
+// so "message" is sent as KEY_MESSAGE.
+//
+// Records too large for a datagram are passed to journald in a memfd, or a
+// temporary file if memfds are not supported. The socket is reopened when
+// writing to it fails. JournalHandler is only supported on Linux.
+func JournalHandler(opts JournalOptions) (Handler, error) {
+	if opts.Path == "" {
+		opts.Path = defaultJournalSocket
+	}
+	if opts.SyslogIdentifier == "" {
+		opts.SyslogIdentifier = filepath.Base(os.Args[0])
+	}
+	return newJournalHandler(opts)
+}
+
+// journalMessage encodes r in the journald native protocol.
+func journalMessage(r *Record, identifier string) []byte {
+	b := &bytes.Buffer{}
+	appendJournalField(b, "MESSAGE", r.Message)
+	appendJournalField(b, "PRIORITY", strconv.Itoa(syslogSeverity(r.Level)))
+	appendJournalField(b, "SYSLOG_IDENTIFIER", identifier)
+	if frame := r.Call.Frame(); frame.PC != 0 {
+		appendJournalField(b, "CODE_FILE", frame.File)
+		appendJournalField(b, "CODE_LINE", strconv.Itoa(frame.Line))
+		appendJournalField(b, "CODE_FUNC", frame.Function)
+	}
+
+	ctx := recordContext(r)
+	for i := 0; i < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		v := ctx[i+1]
+		if !ok {
+			k, v = errorKey, fmt.Sprintf("%+v is not a string key", ctx[i])
+		}
+		appendJournalField(b, journalFieldName(k), fmt.Sprintf("%+v", formatShared(v)))
+	}
+	return b.Bytes()
+}
+
+// appendJournalField writes a field as "NAME=value\n", or as the name, the
+// length of the value as a little endian uint64 and the value if the value
+// contains a newline.
+func appendJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b.WriteByte('\n')
+	b.Write(size[:])
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName turns a context key into a valid journal field name: at
+// most 64 uppercase ASCII letters, digits and underscores, starting with a
+// letter, and none of the fields written by the handler.
+func journalFieldName(k string) string {
+	name := []byte(strings.ToUpper(k))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	// leading underscores are reserved for fields set by journald itself
+	name = bytes.TrimLeft(name, "_")
+	if len(name) == 0 || name[0] <= '9' || journalHandlerFields[string(name)] {
+		name = append([]byte("KEY_"), name...)
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return string(name)
+}
@@ -0,0 +1,139 @@
+//go:build linux
+
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func newJournalHandler(opts JournalOptions) (Handler, error) {
+	h := &journalHandler{opts: opts}
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	return LazyHandler(h), nil
+}
+
+type journalHandler struct {
+	mu     sync.Mutex
+	opts   JournalOptions
+	conn   *net.UnixConn
+	closed bool
+}
+
+func (h *journalHandler) Log(r *Record) error {
+	msg := journalMessage(r, h.opts.SyslogIdentifier)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return errHandlerClosed
+	}
+	if h.conn != nil {
+		if err := h.write(msg); err == nil {
+			return nil
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	if err := h.connect(); err != nil {
+		return err
+	}
+	return h.write(msg)
+}
+
+func (h *journalHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+// connect opens the journald socket. It must be called with h.mu held or
+// before the handler is in use.
+func (h *journalHandler) connect() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: h.opts.Path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	return nil
+}
+
+// write sends msg in a datagram, or in a file if it is too large for one.
+func (h *journalHandler) write(msg []byte) error {
+	_, err := h.conn.Write(msg)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		return h.writeFile(msg)
+	}
+	return err
+}
+
+// writeFile writes msg to a memfd, or an unlinked temporary file, and sends
+// its file descriptor to journald, which reads the message from it.
+func (h *journalHandler) writeFile(msg []byte) error {
+	f, memfd, err := journalFile()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(msg); err != nil {
+		return err
+	}
+	if memfd {
+		// journald only accepts memfds which can't be changed anymore
+		seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+		if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+			return err
+		}
+	}
+
+	// net.UnixConn refuses to send control messages on a connected
+	// datagram socket, so send it on the socket itself
+	rc, err := h.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := unix.UnixRights(int(f.Fd()))
+	var serr error
+	if err := rc.Write(func(fd uintptr) bool {
+		serr = unix.Sendmsg(int(fd), nil, rights, nil, 0)
+		return serr != unix.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// journalFile creates a sealable memfd or, where memfds are not supported,
+// a temporary file which is unlinked right away.
+func journalFile() (*os.File, bool, error) {
+	fd, err := unix.MemfdCreate("journal-message", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err == nil {
+		return os.NewFile(uintptr(fd), "journal-message"), true, nil
+	}
+
+	f, err := os.CreateTemp("/dev/shm", "journal-message-")
+	if err != nil {
+		if f, err = os.CreateTemp("", "journal-message-"); err != nil {
+			return nil, false, err
+		}
+	}
+	os.Remove(f.Name())
+	return f, false, nil
+}
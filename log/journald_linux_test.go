@@ -0,0 +1,160 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-stack/stack"
+	"golang.org/x/sys/unix"
+)
+
+// journalListener listens on a unixgram socket in a temporary directory,
+// standing in for journald.
+func journalListener(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn, path
+}
+
+// parseJournal decodes a message in the journald native protocol.
+func parseJournal(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		nl := bytes.IndexByte(b, '\n')
+		if nl < 0 {
+			t.Fatalf("unterminated field %q", b)
+		}
+		if eq := bytes.IndexByte(b[:nl], '='); eq >= 0 {
+			fields[string(b[:eq])] = string(b[eq+1 : nl])
+			b = b[nl+1:]
+			continue
+		}
+
+		name := string(b[:nl])
+		b = b[nl+1:]
+		if len(b) < 8 {
+			t.Fatalf("field %s has no size", name)
+		}
+		size := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		if uint64(len(b)) < size+1 || b[size] != '\n' {
+			t.Fatalf("field %s is shorter than %d bytes", name, size)
+		}
+		fields[name] = string(b[:size])
+		b = b[size+1:]
+	}
+	return fields
+}
+
+func TestJournalHandlerFields(t *testing.T) {
+	conn, path := journalListener(t)
+	h, err := JournalHandler(JournalOptions{Path: path, SyslogIdentifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	r := testRecord("hello\nworld", "message", "from context", "multi", "a\nb", "_hidden", 1)
+	r.Level = LevelWarning
+	r.Call = stack.Caller(0)
+	if err := h.Log(r); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parseJournal(t, buf[:n])
+	for name, want := range map[string]string{
+		"MESSAGE":           "hello\nworld",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"CODE_FUNC":         "github.com/techarm/toolkit/log.TestJournalHandlerFields",
+		"KEY_MESSAGE":       "from context",
+		"MULTI":             "a\nb",
+		"HIDDEN":            "1",
+	} {
+		if got, ok := fields[name]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if !strings.HasSuffix(fields["CODE_FILE"], "journald_linux_test.go") || fields["CODE_LINE"] == "" {
+		t.Errorf("got call site %s:%s", fields["CODE_FILE"], fields["CODE_LINE"])
+	}
+
+	if err := closeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Log(r); err != errHandlerClosed {
+		t.Errorf("Log after Close returned %v", err)
+	}
+}
+
+func TestJournalHandlerLargeMessage(t *testing.T) {
+	conn, path := journalListener(t)
+	h, err := JournalHandler(JournalOptions{Path: path, SyslogIdentifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	// larger than the socket buffers, so it can't be sent as a datagram
+	msg := strings.Repeat("x", 4<<20)
+	if err := h.Log(testRecord(msg)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, oob := make([]byte, 4096), make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("got a %d byte datagram instead of a file descriptor", n)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("got control messages %v, %v", msgs, err)
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("got file descriptors %v, %v", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal-message")
+	defer f.Close()
+
+	// journald only accepts sealed memfds
+	if seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0); err == nil {
+		if want := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL; seals&want != want {
+			t.Errorf("memfd has seals %#x, want %#x", seals, want)
+		}
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, fi.Size())
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	fields := parseJournal(t, b)
+	if fields["MESSAGE"] != msg || fields["SYSLOG_IDENTIFIER"] != "app" {
+		t.Errorf("got fields %.100q", fields)
+	}
+}
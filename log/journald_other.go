@@ -0,0 +1,9 @@
+//go:build !linux
+
+package log
+
+import "errors"
+
+func newJournalHandler(opts JournalOptions) (Handler, error) {
+	return nil, errors.New("log: journald is only supported on linux")
+}
@@ -1,19 +1,20 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
-	"sync/atomic"
 	"time"
 
-	"github.com/elliotchance/orderedmap/v2"
 	"github.com/go-stack/stack"
 )
 
 const timeKey = "t"
 const lvlKey = "lvl"
 const msgKey = "msg"
+const nameKey = "logger"
 const errorKey = "LOG_ERROR"
 
 // LEVEL is a type for predefined log levels.
@@ -83,8 +84,12 @@ type Record struct {
 	Level    LEVEL
 	Message  string
 	Context  []interface{}
+	Fields   []Field
 	Call     stack.Call
 	KeyNames RecordKeyNames
+
+	// Name is the dotted name of the logger, empty for unnamed loggers.
+	Name string
 }
 
 // RecordKeyNames are the predefined names of the log props used by the Logger interface.
@@ -92,6 +97,15 @@ type RecordKeyNames struct {
 	Time    string
 	Message string
 	Level   string
+	Name    string
+}
+
+// defaultKeyNames are the key names of records created by this package.
+var defaultKeyNames = RecordKeyNames{
+	Time:    timeKey,
+	Message: msgKey,
+	Level:   lvlKey,
+	Name:    nameKey,
 }
 
 // A Logger writes key/value pairs to a Handler
@@ -105,6 +119,10 @@ type Logger interface {
 	// SetHandler updates the logger to write records to the specified handler.
 	SetHandler(h Handler)
 
+	// Named returns a new Logger whose name is this logger's name plus the
+	// given name, separated by a dot.
+	Named(name string) Logger
+
 	// Trace log a message at the trace level
 	Trace(v ...any)
 
@@ -141,50 +159,104 @@ type Logger interface {
 	// Fatalf log a message at the fatal level and arguments are handled in the manner of fmt.Printf.
 	Fatalf(format string, v ...any)
 
-	// Log a message at the given level with context key/value pairs
+	// Tracew log a message at the trace level with alternating key/value pairs.
+	Tracew(msg string, kv ...any)
+
+	// Debugw log a message at the debug level with alternating key/value pairs.
+	Debugw(msg string, kv ...any)
+
+	// Infow log a message at the infomation level with alternating key/value pairs.
+	Infow(msg string, kv ...any)
+
+	// Warnw log a message at the warning level with alternating key/value pairs.
+	Warnw(msg string, kv ...any)
+
+	// Errorw log a message at the error level with alternating key/value pairs.
+	Errorw(msg string, kv ...any)
+
+	// Fatalw log a message at the fatal level with alternating key/value pairs.
+	Fatalw(msg string, kv ...any)
+
+	// TraceContext log a message at the trace level with the registered values found in ctx.
+	TraceContext(ctx context.Context, v ...any)
+
+	// DebugContext log a message at the debug level with the registered values found in ctx.
+	DebugContext(ctx context.Context, v ...any)
+
+	// InfoContext log a message at the infomation level with the registered values found in ctx.
+	InfoContext(ctx context.Context, v ...any)
+
+	// WarnContext log a message at the warning level with the registered values found in ctx.
+	WarnContext(ctx context.Context, v ...any)
+
+	// ErrorContext log a message at the error level with the registered values found in ctx.
+	ErrorContext(ctx context.Context, v ...any)
+
+	// FatalContext log a message at the fatal level with the registered values found in ctx.
+	FatalContext(ctx context.Context, v ...any)
+
+	// With returns a new Logger that has this logger's context plus the given typed fields.
+	With(fields ...Field) Logger
+
+	// Log a message at the given level with typed fields. Unlike Fatal, Log does not exit
+	// the program when level is LevelFatal.
+	Log(level LEVEL, msg string, fields ...Field)
+
+	// WithField returns a new Logger that has this logger's context plus the
+	// given key/value pair. The receiver is not modified.
 	WithField(key string, value any) Logger
 
-	// Log a message at the given level with context key/value pairs
-	WithFields(fileds Fields) Logger
+	// WithFields returns a new Logger that has this logger's context plus the
+	// given fields, added in key order. The receiver is not modified.
+	WithFields(fields Fields) Logger
 }
 
 type logger struct {
+	name    string
 	ctx     []interface{}
+	fields  []Field
 	handler *swapHandler
-	// fields    Fields
-	// fieldPool sync.Pool
-	fields atomic.Value
 }
 
-func (l *logger) write(level LEVEL, msg string) {
-	fields := l.newFields()
+func (l *logger) write(level LEVEL, msg string, extra []interface{}, fields []Field) {
+	l.writeCall(stack.Caller(2), level, msg, extra, fields)
+}
+
+// writeCall is write for callers which determine the call site themselves.
+func (l *logger) writeCall(call stack.Call, level LEVEL, msg string, extra []interface{}, fields []Field) {
+	var h Handler = l.handler
+	if reg := loadRegistry(); reg != nil {
+		if lvl, ok := reg.level(l.name); ok && level < lvl {
+			return
+		}
+		if rh := reg.handler(l.name); rh != nil {
+			h = rh
+		}
+	}
 
-	ctx := make([]any, 0, fields.Len())
-	for _, key := range fields.Keys() {
-		value, _ := fields.Get(key)
-		ctx = append(ctx, key, value)
+	if len(l.fields) > 0 {
+		// never append to l.fields in place, it is shared with children
+		fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
 	}
-	defer l.releaseFields()
-
-	l.handler.Log(&Record{
-		Time:    time.Now(),
-		Level:   level,
-		Message: msg,
-		Context: newContext(l.ctx, ctx),
-		Call:    stack.Caller(2),
-		KeyNames: RecordKeyNames{
-			Time:    timeKey,
-			Message: msgKey,
-			Level:   lvlKey,
-		},
+
+	h.Log(&Record{
+		Time:     time.Now(),
+		Level:    level,
+		Message:  msg,
+		Context:  newContext(l.ctx, extra),
+		Fields:   fields,
+		Call:     call,
+		KeyNames: defaultKeyNames,
+		Name:     l.name,
 	})
 }
 
 func (l *logger) New(ctx ...interface{}) Logger {
 	child := &logger{
+		name:    l.name,
 		ctx:     newContext(l.ctx, ctx),
+		fields:  l.fields,
 		handler: new(swapHandler),
-		// fields:  make(map[string]any),
 	}
 
 	child.SetHandler(l.handler)
@@ -200,69 +272,229 @@ func newContext(prefix []interface{}, suffix []interface{}) []interface{} {
 }
 
 func (l *logger) Trace(v ...any) {
-	l.write(LevelTrace, fmt.Sprint(v...))
+	l.write(LevelTrace, fmt.Sprint(v...), nil, nil)
 }
 
 func (l *logger) Debug(v ...any) {
-	l.write(LevelDebug, fmt.Sprint(v...))
+	l.write(LevelDebug, fmt.Sprint(v...), nil, nil)
 }
 
 func (l *logger) Info(v ...any) {
-	l.write(LevelInfo, fmt.Sprint(v...))
+	l.write(LevelInfo, fmt.Sprint(v...), nil, nil)
 }
 
 func (l *logger) Warn(v ...any) {
-	l.write(LevelWarning, fmt.Sprint(v...))
+	l.write(LevelWarning, fmt.Sprint(v...), nil, nil)
 }
 
 func (l *logger) Error(v ...any) {
-	l.write(LevelError, fmt.Sprint(v...))
+	l.write(LevelError, fmt.Sprint(v...), nil, nil)
 }
 
 func (l *logger) Fatal(v ...any) {
-	l.write(LevelFatal, fmt.Sprint(v...))
+	l.write(LevelFatal, fmt.Sprint(v...), nil, nil)
 	os.Exit(1)
 }
 
 func (l *logger) Tracef(format string, args ...any) {
-	l.write(LevelTrace, fmt.Sprintf(format, args...))
+	l.write(LevelTrace, fmt.Sprintf(format, args...), nil, nil)
 }
 
 func (l *logger) Debugf(format string, args ...any) {
-	l.write(LevelDebug, fmt.Sprintf(format, args...))
+	l.write(LevelDebug, fmt.Sprintf(format, args...), nil, nil)
 }
 
 func (l *logger) Infof(format string, args ...any) {
-	l.write(LevelInfo, fmt.Sprintf(format, args...))
+	l.write(LevelInfo, fmt.Sprintf(format, args...), nil, nil)
 }
 
 func (l *logger) Warnf(format string, args ...any) {
-	l.write(LevelWarning, fmt.Sprintf(format, args...))
+	l.write(LevelWarning, fmt.Sprintf(format, args...), nil, nil)
 }
 
 func (l *logger) Errorf(format string, args ...any) {
-	l.write(LevelError, fmt.Sprintf(format, args...))
+	l.write(LevelError, fmt.Sprintf(format, args...), nil, nil)
 }
 
 func (l *logger) Fatalf(format string, args ...any) {
-	l.write(LevelFatal, fmt.Sprintf(format, args...))
+	l.write(LevelFatal, fmt.Sprintf(format, args...), nil, nil)
+	os.Exit(1)
+}
+
+func (l *logger) Tracew(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	l.write(LevelTrace, msg, ctx, fields)
+}
+
+func (l *logger) Debugw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	l.write(LevelDebug, msg, ctx, fields)
+}
+
+func (l *logger) Infow(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	l.write(LevelInfo, msg, ctx, fields)
+}
+
+func (l *logger) Warnw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	l.write(LevelWarning, msg, ctx, fields)
+}
+
+func (l *logger) Errorw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	l.write(LevelError, msg, ctx, fields)
+}
+
+func (l *logger) Fatalw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	l.write(LevelFatal, msg, ctx, fields)
+	os.Exit(1)
+}
+
+func (l *logger) TraceContext(ctx context.Context, v ...any) {
+	l.write(LevelTrace, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+func (l *logger) DebugContext(ctx context.Context, v ...any) {
+	l.write(LevelDebug, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+func (l *logger) InfoContext(ctx context.Context, v ...any) {
+	l.write(LevelInfo, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+func (l *logger) WarnContext(ctx context.Context, v ...any) {
+	l.write(LevelWarning, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+func (l *logger) ErrorContext(ctx context.Context, v ...any) {
+	l.write(LevelError, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+func (l *logger) FatalContext(ctx context.Context, v ...any) {
+	l.write(LevelFatal, fmt.Sprint(v...), contextValues(ctx), nil)
 	os.Exit(1)
 }
 
 func (l *logger) WithField(key string, value any) Logger {
-	fields := l.newFields()
-	fields.Set(key, value)
-	l.fields.Store(fields)
-	return l
+	return l.with([]interface{}{key, value})
 }
 
 func (l *logger) WithFields(fields Fields) Logger {
-	newFields := l.newFields()
-	for key, value := range fields {
-		newFields.Set(key, value)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ctx := make([]interface{}, 0, len(fields)*2)
+	for _, key := range keys {
+		ctx = append(ctx, key, fields[key])
+	}
+	return l.with(ctx)
+}
+
+// with returns a child logger whose context is a copy of l's context with
+// the given key/value pairs set. Keys which are already present keep their
+// position and get the new value, so l itself is never modified.
+func (l *logger) with(pairs []interface{}) *logger {
+	ctx := make([]interface{}, len(l.ctx), len(l.ctx)+len(pairs))
+	copy(ctx, l.ctx)
+
+outer:
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key := pairs[i].(string)
+		for j := 0; j+1 < len(ctx); j += 2 {
+			if k, ok := ctx[j].(string); ok && k == key {
+				ctx[j+1] = pairs[i+1]
+				continue outer
+			}
+		}
+		ctx = append(ctx, key, pairs[i+1])
+	}
+
+	child := &logger{
+		name:    l.name,
+		ctx:     ctx,
+		fields:  l.fields,
+		handler: new(swapHandler),
+	}
+	child.SetHandler(l.handler)
+	return child
+}
+
+func (l *logger) With(fields ...Field) Logger {
+	child := &logger{
+		name:    l.name,
+		ctx:     l.ctx,
+		fields:  append(l.fields[:len(l.fields):len(l.fields)], fields...),
+		handler: new(swapHandler),
 	}
-	l.fields.Store(newFields)
-	return l
+	child.SetHandler(l.handler)
+	return child
+}
+
+func (l *logger) Named(name string) Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	loggerNames.Store(name, struct{}{})
+
+	child := &logger{
+		name:    name,
+		ctx:     l.ctx,
+		fields:  l.fields,
+		handler: new(swapHandler),
+	}
+	child.SetHandler(l.handler)
+	return child
+}
+
+func (l *logger) Log(level LEVEL, msg string, fields ...Field) {
+	l.write(level, msg, nil, fields)
+}
+
+// keyValues splits the arguments of the *w methods into context pairs and
+// typed fields. A Field may appear anywhere in kv and takes no value. A
+// missing final value is replaced by nil and keys which are not strings
+// are formatted with fmt; both cases are reported under errorKey.
+func keyValues(kv []interface{}) ([]interface{}, []Field) {
+	kv = normalize(kv)
+
+	clean := true
+	for i := 0; i < len(kv) && clean; i += 2 {
+		_, isString := kv[i].(string)
+		clean = isString && i+1 < len(kv)
+	}
+	if clean {
+		return kv, nil
+	}
+
+	var ctx []interface{}
+	var fields []Field
+	for i := 0; i < len(kv); {
+		switch k := kv[i].(type) {
+		case Field:
+			fields = append(fields, k)
+			i++
+			continue
+		case string:
+			if i+1 < len(kv) {
+				ctx = append(ctx, k, kv[i+1])
+			} else {
+				ctx = append(ctx, k, nil, errorKey, "Normalized odd number of arguments by adding nil")
+			}
+		default:
+			var v interface{}
+			if i+1 < len(kv) {
+				v = kv[i+1]
+			}
+			ctx = append(ctx, fmt.Sprintf("%+v", k), v, errorKey, fmt.Sprintf("%+v is not a string key", k))
+		}
+		i += 2
+	}
+	return ctx, fields
 }
 
 func (l *logger) GetHandler() Handler {
@@ -283,22 +515,6 @@ func normalize(ctx []interface{}) []interface{} {
 	return ctx
 }
 
-func (l *logger) releaseFields() {
-	fields := l.fields.Load()
-	if fields != nil {
-		fields = orderedmap.NewOrderedMap[string, any]()
-		l.fields.Store(fields)
-	}
-}
-
-func (l *logger) newFields() *orderedmap.OrderedMap[string, any] {
-	fields := l.fields.Load()
-	if fields != nil {
-		return fields.(*orderedmap.OrderedMap[string, any])
-	}
-	return orderedmap.NewOrderedMap[string, any]()
-}
-
 // Lazy allows you to defer calculation of a logged value that is expensive
 // to compute until it is certain that it must be evaluated with the given filters.
 //
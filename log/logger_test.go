@@ -0,0 +1,141 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// recorder is a handler which keeps the records written to it.
+type recorder struct {
+	mu      sync.Mutex
+	records []*Record
+}
+
+func (h *recorder) Log(r *Record) error {
+	h.mu.Lock()
+	h.records = append(h.records, r)
+	h.mu.Unlock()
+	return nil
+}
+
+// recordValues returns the context and fields of r by key.
+func recordValues(r *Record) map[string][]interface{} {
+	values := make(map[string][]interface{})
+	for i := 0; i+1 < len(r.Context); i += 2 {
+		k := fmt.Sprint(r.Context[i])
+		values[k] = append(values[k], r.Context[i+1])
+	}
+	for _, f := range r.Fields {
+		values[f.Key] = append(values[f.Key], f.Value())
+	}
+	return values
+}
+
+// toInt converts an integer value of any type to int.
+func toInt(v interface{}) int {
+	var n int
+	fmt.Sscan(fmt.Sprint(v), &n)
+	return n
+}
+
+// useRecorder makes the root logger write to a recorder for the duration
+// of the test.
+func useRecorder(t *testing.T) *recorder {
+	h := &recorder{}
+	root.SetHandler(h)
+	t.Cleanup(func() { root.SetHandler(StdoutHandler) })
+	return h
+}
+
+func TestChildLoggersConcurrent(t *testing.T) {
+	const goroutines, iterations = 8, 200
+
+	for _, parent := range []struct {
+		name   string
+		logger Logger
+		ctx    int // number of context values of the parent
+	}{
+		{"root", Root(), 0},
+		{"child", New("parent", "p"), 2},
+		{"with", WithField("parent", "p"), 2},
+	} {
+		t.Run(parent.name, func(t *testing.T) {
+			h := useRecorder(t)
+
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < iterations; i++ {
+						var l Logger
+						switch i % 4 {
+						case 0:
+							l = parent.logger.WithField("g", g)
+						case 1:
+							l = parent.logger.WithFields(Fields{"g": g})
+						case 2:
+							l = parent.logger.With(Int("g", g))
+						case 3:
+							l = parent.logger.New("g", g)
+						}
+						l.WithField("i", i).With(Int("gi", g*iterations+i)).Infow("child", "extra", g)
+						parent.logger.Info("parent")
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			if n := len(h.records); n != 2*goroutines*iterations {
+				t.Fatalf("got %d records, want %d", n, 2*goroutines*iterations)
+			}
+			for _, r := range h.records {
+				values := recordValues(r)
+				if r.Message == "parent" {
+					if len(r.Context) != parent.ctx || len(r.Fields) != 0 {
+						t.Fatalf("parent record has context %v and fields %v", r.Context, r.Fields)
+					}
+					continue
+				}
+
+				g, i := values["g"], values["i"]
+				if len(g) != 1 || len(i) != 1 || len(values["gi"]) != 1 || len(values["extra"]) != 1 {
+					t.Fatalf("child record has context %v and fields %v", r.Context, r.Fields)
+				}
+				if want := fmt.Sprint(toInt(g[0])*iterations + toInt(i[0])); fmt.Sprint(values["gi"][0]) != want {
+					t.Fatalf("child record of g=%v i=%v has gi=%v, want %s", g[0], i[0], values["gi"][0], want)
+				}
+				if fmt.Sprint(values["extra"][0]) != fmt.Sprint(g[0]) {
+					t.Fatalf("child record of g=%v has extra=%v", g[0], values["extra"][0])
+				}
+			}
+		})
+	}
+}
+
+func TestWithFieldDoesNotModifyReceiver(t *testing.T) {
+	h := useRecorder(t)
+
+	parent := New("a", 1)
+	first := parent.WithField("b", 2)
+	second := parent.WithFields(Fields{"a": 3, "c": 4})
+	third := first.With(String("d", "5"))
+
+	parent.Info("parent")
+	first.Info("first")
+	second.Info("second")
+	third.Info("third")
+
+	want := map[string]string{
+		"parent": "map[a:[1]]",
+		"first":  "map[a:[1] b:[2]]",
+		"second": "map[a:[3] c:[4]]",
+		"third":  "map[a:[1] b:[2] d:[5]]",
+	}
+	for _, r := range h.records {
+		if got := fmt.Sprint(recordValues(r)); got != want[r.Message] {
+			t.Errorf("%s: got %s, want %s", r.Message, got, want[r.Message])
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package log
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The registry holds the levels and handlers set for named loggers. It is
+// replaced as a whole on every change, so that logging only needs an
+// atomic load to read it.
+var (
+	registryMu    sync.Mutex
+	registryValue atomic.Value // *registry
+
+	// loggerNames holds the names of all named loggers created so far.
+	loggerNames sync.Map
+)
+
+type registry struct {
+	levels   map[string]LEVEL
+	handlers map[string]Handler
+}
+
+// loadRegistry returns the current registry, nil if nothing is registered.
+func loadRegistry() *registry {
+	reg, _ := registryValue.Load().(*registry)
+	return reg
+}
+
+// SetLevel sets the minimum level of the loggers matching pattern. Records
+// below it are discarded before they reach any handler.
+//
+// A pattern is either a logger name such as "db.pool", which matches only
+// that logger, or a name followed by ".*" such as "db.*", which matches the
+// logger and all of its descendants. The pattern "*" matches every logger,
+// including unnamed ones. When several patterns match, the most specific
+// one applies, so "db.pool" overrides "db.*", which overrides "*".
+func SetLevel(pattern string, lvl LEVEL) {
+	updateRegistry(func(reg *registry) {
+		reg.levels[pattern] = lvl
+	})
+}
+
+// ClearLevel removes the level set for pattern with SetLevel.
+func ClearLevel(pattern string) {
+	updateRegistry(func(reg *registry) {
+		delete(reg.levels, pattern)
+	})
+}
+
+// SetNamedHandler makes the loggers matching pattern write their records
+// to h instead of their own handler. Patterns are matched as by SetLevel.
+// A nil handler removes the handler set for pattern. Shutdown flushes and
+// closes the handlers set here along with the root handler.
+func SetNamedHandler(pattern string, h Handler) {
+	updateRegistry(func(reg *registry) {
+		if h == nil {
+			delete(reg.handlers, pattern)
+		} else {
+			reg.handlers[pattern] = h
+		}
+	})
+}
+
+// namedHandlers returns the handlers set with SetNamedHandler, each once,
+// ordered by pattern.
+func namedHandlers() []Handler {
+	reg := loadRegistry()
+	if reg == nil {
+		return nil
+	}
+	patterns := make([]string, 0, len(reg.handlers))
+	for pattern := range reg.handlers {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var hs []Handler
+	seen := make(map[Handler]bool)
+	for _, pattern := range patterns {
+		h := reg.handlers[pattern]
+		// only pointers are safe map keys, handlers such as FuncHandler or
+		// structs holding one panic when they are compared
+		if reflect.TypeOf(h).Kind() == reflect.Ptr {
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+		}
+		hs = append(hs, h)
+	}
+	return hs
+}
+
+// updateRegistry applies fn to a copy of the registry and stores it.
+func updateRegistry(fn func(reg *registry)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	reg := &registry{
+		levels:   make(map[string]LEVEL),
+		handlers: make(map[string]Handler),
+	}
+	if old := loadRegistry(); old != nil {
+		for k, v := range old.levels {
+			reg.levels[k] = v
+		}
+		for k, v := range old.handlers {
+			reg.handlers[k] = v
+		}
+	}
+	fn(reg)
+
+	if len(reg.levels) == 0 && len(reg.handlers) == 0 {
+		reg = nil
+	}
+	registryValue.Store(reg)
+}
+
+// level returns the level set for the logger name, if any.
+func (reg *registry) level(name string) (LEVEL, bool) {
+	lvl, _, ok := reg.levelPattern(name)
+	return lvl, ok
+}
+
+// exactLevel returns the level set for exactly pattern.
+func (reg *registry) exactLevel(pattern string) (LEVEL, bool) {
+	if reg == nil {
+		return 0, false
+	}
+	lvl, ok := reg.levels[pattern]
+	return lvl, ok
+}
+
+// levelPattern is like level but also returns the pattern the level was
+// set for.
+func (reg *registry) levelPattern(name string) (LEVEL, string, bool) {
+	if reg == nil || len(reg.levels) == 0 {
+		return 0, "", false
+	}
+	var lvl LEVEL
+	var match string
+	found := false
+	lookupPatterns(name, func(pattern string) bool {
+		lvl, found = reg.levels[pattern]
+		match = pattern
+		return found
+	})
+	return lvl, match, found
+}
+
+// handler returns the handler set for the logger name, or nil.
+func (reg *registry) handler(name string) Handler {
+	if reg == nil || len(reg.handlers) == 0 {
+		return nil
+	}
+	var h Handler
+	lookupPatterns(name, func(pattern string) bool {
+		h = reg.handlers[pattern]
+		return h != nil
+	})
+	return h
+}
+
+// lookupPatterns calls fn with the patterns matching the logger name, from
+// the most to the least specific, until fn returns true.
+func lookupPatterns(name string, fn func(pattern string) bool) {
+	if name != "" {
+		if fn(name) {
+			return
+		}
+		for p := name; ; {
+			if fn(p + ".*") {
+				return
+			}
+			i := strings.LastIndexByte(p, '.')
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+	}
+	fn("*")
+}
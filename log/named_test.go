@@ -0,0 +1,38 @@
+package log
+
+import "testing"
+
+// valueHandler is a handler whose type is comparable, but whose values
+// panic as map keys because its field holds a function.
+type valueHandler struct {
+	h Handler
+}
+
+func (h valueHandler) Log(r *Record) error { return h.h.Log(r) }
+
+func TestNamedHandlers(t *testing.T) {
+	shared := &recorder{}
+	handlers := map[string]Handler{
+		"a":   shared,
+		"b":   shared,
+		"c.*": valueHandler{FuncHandler(func(r *Record) error { return nil })},
+		"d":   valueHandler{FuncHandler(func(r *Record) error { return nil })},
+		"e":   FuncHandler(func(r *Record) error { return nil }),
+	}
+	for pattern, h := range handlers {
+		SetNamedHandler(pattern, h)
+	}
+	t.Cleanup(func() {
+		for pattern := range handlers {
+			SetNamedHandler(pattern, nil)
+		}
+	})
+
+	hs := namedHandlers()
+	if len(hs) != 4 {
+		t.Fatalf("got %d handlers, want 4", len(hs))
+	}
+	if hs[0] != shared {
+		t.Errorf("got %T first, want the shared recorder", hs[0])
+	}
+}
@@ -0,0 +1,327 @@
+package log
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of the connection of a NetHandler.
+type ConnState int
+
+// List of connection states
+const (
+	// ConnConnected is reported when a connection has been established.
+	ConnConnected ConnState = iota
+	// ConnDisconnected is reported when a connection failed or could not
+	// be established.
+	ConnDisconnected
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnDisconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+const (
+	defaultNetBufferSize   = 1024
+	defaultNetDialTimeout  = 5 * time.Second
+	defaultNetWriteTimeout = 5 * time.Second
+	defaultNetMinBackoff   = 100 * time.Millisecond
+	defaultNetMaxBackoff   = 30 * time.Second
+)
+
+// NetOptions configures a NetHandler.
+type NetOptions struct {
+	// TLSConfig enables TLS for stream networks such as "tcp".
+	TLSConfig *tls.Config
+
+	// DialTimeout limits every connection attempt. Defaults to 5 seconds.
+	DialTimeout time.Duration
+
+	// WriteTimeout limits every write. Defaults to 5 seconds.
+	WriteTimeout time.Duration
+
+	// MinBackoff is the delay before the first reconnection attempt. It
+	// doubles with every failed attempt up to MaxBackoff. Defaults to 100
+	// milliseconds and 30 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// BufferSize is the number of records kept while disconnected. When
+	// it is exceeded the oldest records are dropped. Defaults to 1024.
+	BufferSize int
+
+	// OnStateChange, if set, is called whenever the connection is
+	// established or lost and after every failed connection attempt,
+	// with the error which caused the failure. It must not block.
+	OnStateChange func(state ConnState, err error)
+}
+
+// NetHandler returns a handler which writes log records formatted with fmtr
+// to a connection to addr on the given network, such as "tcp" or "udp".
+// It is NetHandlerEx with the default options.
+func NetHandler(network, addr string, fmtr Format) Handler {
+	return NetHandlerEx(network, addr, fmtr, NetOptions{})
+}
+
+// NetHandlerEx returns a handler which writes log records formatted with
+// fmtr to a connection to addr on the given network. The connection is
+// dialed when the first record is logged and, if it fails, redialed from a
+// background goroutine with exponential backoff. Meanwhile up to
+// opts.BufferSize records are kept and written once the connection is back;
+// the number of records dropped beyond that is reported in a record of its
+// own.
+//
+// Flushing the handler retries the connection right away and waits for the
+// buffered records to be written, up to opts.DialTimeout plus
+// opts.WriteTimeout. Closing the handler flushes it and closes the
+// connection; records which still couldn't be written are lost.
+func NetHandlerEx(network, addr string, fmtr Format, opts NetOptions) Handler {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultNetBufferSize
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaultNetDialTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultNetWriteTimeout
+	}
+	backoffDefaults(&opts.MinBackoff, &opts.MaxBackoff, defaultNetMinBackoff, defaultNetMaxBackoff)
+
+	return LazyHandler(&netHandler{
+		network: network,
+		addr:    addr,
+		fmtr:    fmtr,
+		opts:    opts,
+		done:    make(chan struct{}),
+		retry:   make(chan struct{}, 1),
+		attempt: make(chan struct{}),
+	})
+}
+
+type netHandler struct {
+	network string
+	addr    string
+	fmtr    Format
+	opts    NetOptions
+	done    chan struct{}
+	retry   chan struct{}
+
+	mu      sync.Mutex
+	attempt chan struct{} // closed when a connection attempt is done
+	conn    net.Conn
+	buf     [][]byte
+	dropped int
+	dialing bool
+	closed  bool
+}
+
+func (h *netHandler) Log(r *Record) error {
+	msg := h.fmtr.Format(r)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return errHandlerClosed
+	}
+
+	var err error
+	if h.conn != nil {
+		if err = h.write(msg); err == nil {
+			h.mu.Unlock()
+			return nil
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	h.buffer(msg)
+	dial := !h.dialing
+	h.dialing = true
+	h.mu.Unlock()
+
+	if err != nil {
+		h.notify(ConnDisconnected, err)
+	}
+	if dial {
+		go h.reconnect()
+	}
+	return nil
+}
+
+// Flush waits for an attempt to write the buffered records, cutting the
+// backoff short, and reports an error if records are still waiting for
+// the connection afterwards.
+func (h *netHandler) Flush() error {
+	h.mu.Lock()
+	if h.closed || !h.dialing {
+		h.mu.Unlock()
+		return nil
+	}
+	attempt := h.attempt
+	h.mu.Unlock()
+
+	select {
+	case h.retry <- struct{}{}:
+	default:
+	}
+	timer := time.NewTimer(h.opts.DialTimeout + h.opts.WriteTimeout)
+	defer timer.Stop()
+	select {
+	case <-attempt:
+	case <-timer.C:
+	case <-h.done:
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n := len(h.buf); n > 0 {
+		return fmt.Errorf("log: %s %s: not connected, %d records buffered", h.network, h.addr, n)
+	}
+	return nil
+}
+
+func (h *netHandler) Close() error {
+	ferr := h.Flush()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	close(h.done)
+
+	if h.conn == nil {
+		return ferr
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	if err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// buffer keeps msg until the connection is back, dropping the oldest
+// message if the buffer is full. It must be called with h.mu held.
+func (h *netHandler) buffer(msg []byte) {
+	if len(h.buf) >= h.opts.BufferSize {
+		h.buf[0] = nil
+		h.buf = h.buf[1:]
+		h.dropped++
+	}
+	h.buf = append(h.buf, msg)
+}
+
+// write writes msg to the connection. It must be called with h.mu held.
+func (h *netHandler) write(msg []byte) error {
+	h.conn.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+	_, err := h.conn.Write(msg)
+	return err
+}
+
+// reconnect dials until a connection is established and the buffered
+// records have been written to it, or the handler is closed.
+func (h *netHandler) reconnect() {
+	backoff := h.opts.MinBackoff
+	first := true
+	for {
+		if !first {
+			select {
+			case <-time.After(backoffDelay(backoff)):
+			case <-h.retry:
+			case <-h.done:
+				return
+			}
+			backoff = nextBackoff(backoff, h.opts.MaxBackoff)
+		}
+		first = false
+
+		conn, err := h.dial()
+		if err != nil {
+			h.mu.Lock()
+			h.attempted()
+			h.mu.Unlock()
+			h.notify(ConnDisconnected, err)
+			continue
+		}
+
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			conn.Close()
+			return
+		}
+		h.conn = conn
+		err = h.drain()
+		if err != nil {
+			h.conn.Close()
+			h.conn = nil
+		} else {
+			h.dialing = false
+		}
+		h.attempted()
+		h.mu.Unlock()
+
+		if err != nil {
+			h.notify(ConnDisconnected, err)
+			continue
+		}
+		h.notify(ConnConnected, nil)
+		return
+	}
+}
+
+// attempted wakes up the callers of Flush waiting for a connection
+// attempt. It must be called with h.mu held.
+func (h *netHandler) attempted() {
+	close(h.attempt)
+	h.attempt = make(chan struct{})
+}
+
+func (h *netHandler) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: h.opts.DialTimeout}
+	if h.opts.TLSConfig != nil {
+		return tls.DialWithDialer(dialer, h.network, h.addr, h.opts.TLSConfig)
+	}
+	return dialer.Dial(h.network, h.addr)
+}
+
+// drain writes the buffered messages, preceded by the number of dropped
+// ones, if any. Messages are only removed from the buffer once they have
+// been written. It must be called with h.mu held.
+func (h *netHandler) drain() error {
+	if h.dropped > 0 {
+		msg := h.fmtr.Format(droppedRecord(int64(h.dropped)))
+		if err := h.write(msg); err != nil {
+			return err
+		}
+		h.dropped = 0
+	}
+
+	for len(h.buf) > 0 {
+		if err := h.write(h.buf[0]); err != nil {
+			return err
+		}
+		h.buf[0] = nil
+		h.buf = h.buf[1:]
+	}
+	h.buf = nil
+	return nil
+}
+
+func (h *netHandler) notify(state ConnState, err error) {
+	if h.opts.OnStateChange != nil {
+		h.opts.OnStateChange(state, err)
+	}
+}
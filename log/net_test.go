@@ -0,0 +1,255 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineFormat formats the message and the context of a record as a line of
+// space separated values.
+var lineFormat = FormatFunc(func(r *Record) []byte {
+	return []byte(fmt.Sprintln(append([]interface{}{r.Message}, r.Context...)...))
+})
+
+// stateRecorder keeps the state changes reported by a NetHandler along
+// with their time.
+type stateRecorder struct {
+	mu      sync.Mutex
+	states  []ConnState
+	times   []time.Time
+	changed chan struct{}
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{changed: make(chan struct{}, 1)}
+}
+
+func (s *stateRecorder) notify(state ConnState, err error) {
+	s.mu.Lock()
+	s.states = append(s.states, state)
+	s.times = append(s.times, time.Now())
+	s.mu.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits until n state changes have been reported and returns them.
+func (s *stateRecorder) wait(t *testing.T, n int) ([]ConnState, []time.Time) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		s.mu.Lock()
+		states, times := append([]ConnState(nil), s.states...), append([]time.Time(nil), s.times...)
+		s.mu.Unlock()
+		if len(states) >= n {
+			return states, times
+		}
+		select {
+		case <-s.changed:
+		case <-timeout:
+			t.Fatalf("got %d state changes, want %d: %v", len(states), n, states)
+		}
+	}
+}
+
+// closedAddr returns a local TCP address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func readLines(t *testing.T, conn net.Conn, n int) []string {
+	t.Helper()
+	r := bufio.NewReader(conn)
+	var lines []string
+	for len(lines) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read %q: %v", lines, err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	return lines
+}
+
+func TestNetHandlerBackoff(t *testing.T) {
+	const minBackoff, maxBackoff = 20 * time.Millisecond, 80 * time.Millisecond
+
+	states := newStateRecorder()
+	h := NetHandlerEx("tcp", closedAddr(t), lineFormat, NetOptions{
+		MinBackoff:    minBackoff,
+		MaxBackoff:    maxBackoff,
+		OnStateChange: states.notify,
+	})
+	defer closeHandler(h)
+	h.Log(testRecord("hello"))
+
+	got, times := states.wait(t, 6)
+	backoff := minBackoff
+	for i := 1; i < len(times); i++ {
+		if got[i] != ConnDisconnected {
+			t.Fatalf("state %d is %v", i, got[i])
+		}
+		if d := times[i].Sub(times[i-1]); d < backoff {
+			t.Errorf("attempt %d came %v after the previous one, want at least %v", i+1, d, backoff)
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func TestNetHandlerBuffering(t *testing.T) {
+	addr := closedAddr(t)
+	states := newStateRecorder()
+	h := NetHandlerEx("tcp", addr, lineFormat, NetOptions{
+		MinBackoff:    10 * time.Millisecond,
+		MaxBackoff:    20 * time.Millisecond,
+		BufferSize:    3,
+		OnStateChange: states.notify,
+	})
+	defer closeHandler(h)
+
+	for i := 1; i <= 5; i++ {
+		if err := h.Log(testRecord("record", "i", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := flushHandler(h); err == nil || !strings.Contains(err.Error(), "3 records buffered") {
+		t.Errorf("Flush returned %v while disconnected", err)
+	}
+	states.wait(t, 1)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	want := []string{
+		"dropped log records dropped 2",
+		"record i 3",
+		"record i 4",
+		"record i 5",
+	}
+	if got := readLines(t, conn, len(want)); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got, _ := states.wait(t, 2)
+	if got[len(got)-1] != ConnConnected {
+		t.Errorf("last state is %v, want connected", got[len(got)-1])
+	}
+	if err := flushHandler(h); err != nil {
+		t.Errorf("Flush returned %v while connected", err)
+	}
+}
+
+func TestNetHandlerFlush(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		flush func(Handler) error
+	}{
+		{"Flush", flushHandler},
+		{"Close", closeHandler},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			addr := closedAddr(t)
+			states := newStateRecorder()
+			h := NetHandlerEx("tcp", addr, lineFormat, NetOptions{
+				MinBackoff:    time.Hour,
+				OnStateChange: states.notify,
+			})
+			defer closeHandler(h)
+
+			h.Log(testRecord("first"))
+			h.Log(testRecord("second"))
+			states.wait(t, 1)
+
+			// the next attempt is an hour away, unless the handler is
+			// flushed
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			if err := test.flush(h); err != nil {
+				t.Fatalf("%s returned %v", test.name, err)
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if got := readLines(t, conn, 2); got[0] != "first" || got[1] != "second" {
+				t.Errorf("got %q", got)
+			}
+		})
+	}
+}
+
+func TestNetHandlerReconnect(t *testing.T) {
+	ln, conns := tcpListener(t)
+	states := newStateRecorder()
+	h := NetHandlerEx("tcp", ln.Addr().String(), lineFormat, NetOptions{
+		MinBackoff:    10 * time.Millisecond,
+		OnStateChange: states.notify,
+	})
+
+	h.Log(testRecord("first"))
+	first := accept(t, conns)
+	if got := readLines(t, first, 1); got[0] != "first" {
+		t.Fatalf("got %q", got)
+	}
+	states.wait(t, 1)
+	first.Close()
+
+	// writes succeed until the handler learns that the connection was
+	// closed, so keep logging until it reconnects
+	var second net.Conn
+	for i := 0; second == nil; i++ {
+		if i == 100 {
+			t.Fatal("handler did not reconnect")
+		}
+		h.Log(testRecord("again"))
+		select {
+		case second = <-conns:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got := readLines(t, second, 1); got[0] != "again" {
+		t.Fatalf("got %q", got)
+	}
+	if got, _ := states.wait(t, 3); got[1] != ConnDisconnected || got[2] != ConnConnected {
+		t.Errorf("got states %v", got)
+	}
+
+	if err := closeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Log(testRecord("closed")); err != errHandlerClosed {
+		t.Fatalf("Log after Close returned %v", err)
+	}
+}
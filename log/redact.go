@@ -0,0 +1,287 @@
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+)
+
+const (
+	defaultRedactMask = "[REDACTED]"
+	maxRedactDepth    = 8
+)
+
+// DefaultRedactKeys are the keys masked by RedactHandler when no keys are
+// configured.
+var DefaultRedactKeys = []string{
+	"password", "passwd", "secret", "*_secret", "token", "*_token",
+	"authorization", "cookie", "api_key", "apikey",
+}
+
+// RedactOptions configures a RedactHandler.
+type RedactOptions struct {
+	// Keys lists the keys whose values are masked. Keys are compared
+	// case-insensitively and may be glob patterns as accepted by
+	// path.Match, such as "*_token". Defaults to DefaultRedactKeys.
+	Keys []string
+
+	// Mask replaces the masked values, "[REDACTED]" by default.
+	Mask string
+
+	// Hash replaces values by the first 16 hex digits of their HMAC-SHA256
+	// under HashKey instead of Mask, so equal values can still be
+	// correlated. Without the key, short secrets could be recovered from
+	// a plain digest by trying every candidate.
+	Hash bool
+
+	// HashKey is the secret HMAC key, required if Hash is set.
+	HashKey []byte
+}
+
+// RedactHandler returns a handler which masks the values of sensitive keys
+// before writing records to h. Keys are looked up in the record context,
+// the typed fields and, recursively, in maps and structs used as values;
+// struct fields are matched by their JSON name if they have one. Because
+// the masking happens on the record, it applies to every Format.
+//
+// The record passed to h is a copy, the values logged by the caller are
+// never modified.
+func RedactHandler(h Handler, opts RedactOptions) (Handler, error) {
+	if opts.Hash && len(opts.HashKey) == 0 {
+		return nil, errors.New("log: RedactOptions.HashKey is required with Hash")
+	}
+	keys := opts.Keys
+	if keys == nil {
+		keys = DefaultRedactKeys
+	}
+	if opts.Mask == "" {
+		opts.Mask = defaultRedactMask
+	}
+
+	rd := &redactHandler{h: h, opts: opts}
+	for _, k := range keys {
+		rd.patterns = append(rd.patterns, strings.ToLower(k))
+	}
+	return rd, nil
+}
+
+type redactHandler struct {
+	h        Handler
+	opts     RedactOptions
+	patterns []string
+}
+
+func (rd *redactHandler) Log(r *Record) error {
+	var ctx []interface{}
+	for i := 0; i+1 < len(r.Context); i += 2 {
+		v, changed := rd.pair(r.Context[i], r.Context[i+1], 0)
+		if !changed {
+			continue
+		}
+		if ctx == nil {
+			ctx = make([]interface{}, len(r.Context))
+			copy(ctx, r.Context)
+		}
+		ctx[i+1] = v
+	}
+
+	var fields []Field
+	for i, f := range r.Fields {
+		nf, changed := rd.field(f)
+		if !changed {
+			continue
+		}
+		if fields == nil {
+			fields = make([]Field, len(r.Fields))
+			copy(fields, r.Fields)
+		}
+		fields[i] = nf
+	}
+
+	if ctx == nil && fields == nil {
+		return rd.h.Log(r)
+	}
+
+	nr := *r
+	if ctx != nil {
+		nr.Context = ctx
+	}
+	if fields != nil {
+		nr.Fields = fields
+	}
+	return rd.h.Log(&nr)
+}
+
+func (rd *redactHandler) Flush() error {
+	return flushHandler(rd.h)
+}
+
+func (rd *redactHandler) Close() error {
+	return closeHandler(rd.h)
+}
+
+// match reports whether key is one of the sensitive keys.
+func (rd *redactHandler) match(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range rd.patterns {
+		if p == key {
+			return true
+		}
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (rd *redactHandler) mask(v interface{}) string {
+	if !rd.opts.Hash {
+		return rd.opts.Mask
+	}
+	mac := hmac.New(sha256.New, rd.opts.HashKey)
+	fmt.Fprintf(mac, "%+v", v)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// pair returns the redacted value of a key/value pair.
+func (rd *redactHandler) pair(k, v interface{}, depth int) (interface{}, bool) {
+	if key, ok := k.(string); ok && rd.match(key) {
+		return rd.mask(v), true
+	}
+	return rd.value(v, depth)
+}
+
+func (rd *redactHandler) field(f Field) (Field, bool) {
+	if rd.match(f.Key) {
+		return String(f.Key, rd.mask(f.Value())), true
+	}
+	if f.Type != AnyType {
+		return f, false
+	}
+	v, changed := rd.value(f.Interface, 0)
+	if !changed {
+		return f, false
+	}
+	return Field{Key: f.Key, Type: AnyType, Interface: v}, true
+}
+
+// value returns a copy of v with sensitive keys masked in nested maps,
+// structs and slices. The second result is false if nothing was masked,
+// in which case v is returned as is.
+func (rd *redactHandler) value(v interface{}, depth int) (interface{}, bool) {
+	if v == nil || depth >= maxRedactDepth {
+		return v, false
+	}
+
+	switch val := v.(type) {
+	case string, bool, int, int64, float64, error, fmt.Stringer, Lazy:
+		return v, false
+	case Fields:
+		return rd.stringMap(val, depth)
+	case Ctx:
+		return rd.stringMap(val, depth)
+	case map[string]interface{}:
+		return rd.stringMap(val, depth)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+			return v, false
+		}
+		return rd.structValue(rv.Elem(), depth)
+
+	case reflect.Struct:
+		return rd.structValue(rv, depth)
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			m[it.Key().String()] = it.Value().Interface()
+		}
+		if out, changed := rd.stringMap(m, depth); changed {
+			return out, true
+		}
+		return v, false
+
+	case reflect.Slice, reflect.Array:
+		var out []interface{}
+		for i := 0; i < rv.Len(); i++ {
+			ev, changed := rd.value(rv.Index(i).Interface(), depth+1)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = make([]interface{}, rv.Len())
+				for j := 0; j < rv.Len(); j++ {
+					out[j] = rv.Index(j).Interface()
+				}
+			}
+			out[i] = ev
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	}
+	return v, false
+}
+
+func (rd *redactHandler) stringMap(m map[string]interface{}, depth int) (interface{}, bool) {
+	var out map[string]interface{}
+	for k, v := range m {
+		nv, changed := rd.pair(k, v, depth+1)
+		if !changed {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(m))
+			for k2, v2 := range m {
+				out[k2] = v2
+			}
+		}
+		out[k] = nv
+	}
+	if out == nil {
+		return m, false
+	}
+	return out, true
+}
+
+// structValue converts a struct with sensitive fields into a map keyed by
+// the field names, as they would appear in JSON.
+func (rd *redactHandler) structValue(rv reflect.Value, depth int) (interface{}, bool) {
+	t := rv.Type()
+	m := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Name
+		if tag, ok := sf.Tag.Lookup("json"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		m[name] = rv.Field(i).Interface()
+	}
+
+	if out, changed := rd.stringMap(m, depth); changed {
+		return out, true
+	}
+	return rv.Interface(), false
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -21,7 +22,6 @@ func init() {
 	root = &logger{
 		ctx:     []interface{}{},
 		handler: new(swapHandler),
-		// fields:  make(map[string]any),
 	}
 	root.SetHandler(StdoutHandler)
 }
@@ -32,78 +32,201 @@ func New(ctx ...interface{}) Logger {
 	return root.New(ctx...)
 }
 
+// Named returns a new logger with the given name.
+// Named is a convenient alias for Root().Named
+func Named(name string) Logger {
+	return root.Named(name)
+}
+
 // Root returns the root logger
 func Root() Logger {
 	return root
 }
 
+// Shutdown flushes and closes every handler reachable from the root
+// logger and the handlers set with SetNamedHandler, after writing the
+// incomplete lines held by the writers returned by WriterEx. It should be
+// called once before the program exits to make sure buffered records have
+// been written. If ctx is done before the handlers finish, Shutdown returns the
+// context's error.
+func Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		pendingWriters.flush()
+		hs := append([]Handler{root.handler}, namedHandlers()...)
+		var err error
+		for _, h := range hs {
+			if ferr := flushHandler(h); err == nil {
+				err = ferr
+			}
+		}
+		for _, h := range hs {
+			if cerr := closeHandler(h); err == nil {
+				err = cerr
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // The following functions bypass the exported logger methods (logger.Debug,
 // etc.) to keep the call depth the same for all paths to logger.write so
 // runtime.Caller(2) always refers to the call site in client code.
 
 // Trace is a convenient alias for Root().Trace
 func Trace(v ...any) {
-	root.write(LevelTrace, fmt.Sprint(v...))
+	root.write(LevelTrace, fmt.Sprint(v...), nil, nil)
 }
 
 // Debug is a convenient alias for Root().Debug
 func Debug(v ...any) {
-	root.write(LevelDebug, fmt.Sprint(v...))
+	root.write(LevelDebug, fmt.Sprint(v...), nil, nil)
 }
 
 // Info is a convenient alias for Root().Info
 func Info(v ...any) {
-	root.write(LevelInfo, fmt.Sprint(v...))
+	root.write(LevelInfo, fmt.Sprint(v...), nil, nil)
 }
 
 // Warn is a convenient alias for Root().Warn
 func Warn(v ...any) {
-	root.write(LevelWarning, fmt.Sprint(v...))
+	root.write(LevelWarning, fmt.Sprint(v...), nil, nil)
 }
 
 // Error is a convenient alias for Root().Error
 func Error(v ...any) {
-	root.write(LevelError, fmt.Sprint(v...))
+	root.write(LevelError, fmt.Sprint(v...), nil, nil)
 }
 
 // Fatal is a convenient alias for Root().Fatal
 func Fatal(v ...any) {
-	root.write(LevelFatal, fmt.Sprint(v...))
+	root.write(LevelFatal, fmt.Sprint(v...), nil, nil)
 	os.Exit(1)
 }
 
 // Tracef is a convenient alias for Root().Debugf
 func Tracef(format string, v ...any) {
-	root.write(LevelTrace, fmt.Sprintf(format, v...))
+	root.write(LevelTrace, fmt.Sprintf(format, v...), nil, nil)
 }
 
 // Debugf is a convenient alias for Root().Debugf
 func Debugf(format string, v ...any) {
-	root.write(LevelDebug, fmt.Sprintf(format, v...))
+	root.write(LevelDebug, fmt.Sprintf(format, v...), nil, nil)
 }
 
 // Infof is a convenient alias for Root().Infof
 func Infof(format string, v ...any) {
-	root.write(LevelInfo, fmt.Sprintf(format, v...))
+	root.write(LevelInfo, fmt.Sprintf(format, v...), nil, nil)
 }
 
 // Warnf is a convenient alias for Root().Warnf
 func Warnf(format string, v ...any) {
-	root.write(LevelWarning, fmt.Sprintf(format, v...))
+	root.write(LevelWarning, fmt.Sprintf(format, v...), nil, nil)
 
 }
 
 // Errorf is a convenient alias for Root().Errorf
 func Errorf(format string, v ...any) {
-	root.write(LevelError, fmt.Sprintf(format, v...))
+	root.write(LevelError, fmt.Sprintf(format, v...), nil, nil)
 }
 
 // Fatalf is a convenient alias for Root().Fatalf
 func Fatalf(format string, v ...any) {
-	root.write(LevelFatal, fmt.Sprintf(format, v...))
+	root.write(LevelFatal, fmt.Sprintf(format, v...), nil, nil)
+	os.Exit(1)
+}
+
+// Tracew is a convenient alias for Root().Tracew
+func Tracew(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	root.write(LevelTrace, msg, ctx, fields)
+}
+
+// Debugw is a convenient alias for Root().Debugw
+func Debugw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	root.write(LevelDebug, msg, ctx, fields)
+}
+
+// Infow is a convenient alias for Root().Infow
+func Infow(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	root.write(LevelInfo, msg, ctx, fields)
+}
+
+// Warnw is a convenient alias for Root().Warnw
+func Warnw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	root.write(LevelWarning, msg, ctx, fields)
+}
+
+// Errorw is a convenient alias for Root().Errorw
+func Errorw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	root.write(LevelError, msg, ctx, fields)
+}
+
+// Fatalw is a convenient alias for Root().Fatalw
+func Fatalw(msg string, kv ...any) {
+	ctx, fields := keyValues(kv)
+	root.write(LevelFatal, msg, ctx, fields)
 	os.Exit(1)
 }
 
+// TraceContext logs a message at the trace level with the logger stored
+// in ctx, see FromContext.
+func TraceContext(ctx context.Context, v ...any) {
+	contextLogger(ctx).write(LevelTrace, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+// DebugContext logs a message at the debug level with the logger stored
+// in ctx, see FromContext.
+func DebugContext(ctx context.Context, v ...any) {
+	contextLogger(ctx).write(LevelDebug, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+// InfoContext logs a message at the infomation level with the logger stored
+// in ctx, see FromContext.
+func InfoContext(ctx context.Context, v ...any) {
+	contextLogger(ctx).write(LevelInfo, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+// WarnContext logs a message at the warning level with the logger stored
+// in ctx, see FromContext.
+func WarnContext(ctx context.Context, v ...any) {
+	contextLogger(ctx).write(LevelWarning, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+// ErrorContext logs a message at the error level with the logger stored
+// in ctx, see FromContext.
+func ErrorContext(ctx context.Context, v ...any) {
+	contextLogger(ctx).write(LevelError, fmt.Sprint(v...), contextValues(ctx), nil)
+}
+
+// FatalContext logs a message at the fatal level with the logger stored
+// in ctx, see FromContext.
+func FatalContext(ctx context.Context, v ...any) {
+	contextLogger(ctx).write(LevelFatal, fmt.Sprint(v...), contextValues(ctx), nil)
+	os.Exit(1)
+}
+
+// Log is a convenient alias for Root().Log
+func Log(level LEVEL, msg string, fields ...Field) {
+	root.write(level, msg, nil, fields)
+}
+
+// With is a convenient alias for Root().With
+func With(fields ...Field) Logger {
+	return root.With(fields...)
+}
+
 // WithField is a convenient alias for Root().WithField
 func WithField(k string, v any) Logger {
 	return root.WithField(k, v)
@@ -0,0 +1,443 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressSuffix   = ".gz"
+)
+
+// RotateOptions controls when a RotatingFileHandler starts a new file and
+// which of the old files it keeps.
+type RotateOptions struct {
+	// MaxSize is the size in bytes after which the file is rotated.
+	// Zero disables size based rotation.
+	MaxSize int64
+
+	// Interval rotates the file whenever the wall clock crosses a
+	// multiple of Interval, e.g. every hour or every 24 hours. The
+	// boundaries are computed from the zero time in UTC.
+	// Zero disables time based rotation.
+	Interval time.Duration
+
+	// MaxBackups is the maximum number of old files to keep.
+	// Zero keeps all of them.
+	MaxBackups int
+
+	// MaxAge is the maximum age of old files, determined by the timestamp
+	// in their name. Zero keeps files regardless of their age.
+	MaxAge time.Duration
+
+	// Compress gzips rotated files in the background.
+	Compress bool
+
+	// Symlink, if set, is the path of a symbolic link to the file being
+	// written, e.g. "logs/current".
+	Symlink string
+
+	// LocalTime uses the local time zone for the timestamps in file names.
+	// The default is UTC.
+	LocalTime bool
+}
+
+// RotatingFileHandler returns a handler which writes log records to path
+// using the given format, appending to the file if it exists. When the file
+// would grow beyond opts.MaxSize or when opts.Interval elapses, it is
+// renamed after the time it was started, "logs/app.log" becoming
+// "logs/app-2006-01-02T15-04-05.000.log", and a new file is started at
+// path.
+//
+// Rotated files are compressed and pruned by a background goroutine.
+// Closing the handler closes the current file and waits for that goroutine
+// to finish.
+func RotatingFileHandler(path string, fmtr Format, opts RotateOptions) (Handler, error) {
+	return newRotatingFileHandler(path, fmtr, opts, nil)
+}
+
+// newRotatingFileHandler returns a RotatingFileHandler whose background
+// goroutine waits for hold to be closed, if it is set, before it touches
+// any file.
+func newRotatingFileHandler(path string, fmtr Format, opts RotateOptions, hold <-chan struct{}) (Handler, error) {
+	ext := filepath.Ext(path)
+	h := &rotatingFileHandler{
+		fmtr:   fmtr,
+		opts:   opts,
+		path:   path,
+		dir:    filepath.Dir(path),
+		prefix: strings.TrimSuffix(filepath.Base(path), ext) + "-",
+		ext:    ext,
+		hold:   hold,
+		millCh: make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := h.open(h.now()); err != nil {
+		return nil, err
+	}
+	if opts.Symlink != "" {
+		if err := h.link(); err != nil {
+			liveFiles.remove(h.file)
+			h.file.Close()
+			return nil, err
+		}
+	}
+
+	go h.mill()
+	h.triggerMill()
+	return LazyHandler(h), nil
+}
+
+type rotatingFileHandler struct {
+	mu     sync.Mutex
+	fmtr   Format
+	opts   RotateOptions
+	path   string
+	dir    string
+	prefix string
+	ext    string
+	file   *os.File
+	start  time.Time
+	size   int64
+	next   time.Time
+	closed bool
+
+	hold   <-chan struct{}
+	millCh chan struct{}
+	quit   chan struct{}
+	done   chan struct{}
+}
+
+func (h *rotatingFileHandler) Log(r *Record) error {
+	b := h.fmtr.Format(r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return os.ErrClosed
+	}
+
+	now := h.now()
+	if (h.opts.MaxSize > 0 && h.size > 0 && h.size+int64(len(b)) > h.opts.MaxSize) ||
+		(h.opts.Interval > 0 && !now.Before(h.next)) {
+		if err := h.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := h.file.Write(b)
+	h.size += int64(n)
+	return err
+}
+
+func (h *rotatingFileHandler) Flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	return h.file.Sync()
+}
+
+func (h *rotatingFileHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	liveFiles.remove(h.file)
+	err := h.file.Close()
+	close(h.millCh)
+	close(h.quit)
+	h.mu.Unlock()
+
+	<-h.done
+	return err
+}
+
+func (h *rotatingFileHandler) now() time.Time {
+	if h.opts.LocalTime {
+		return time.Now()
+	}
+	return time.Now().UTC()
+}
+
+// rotate renames the current file after the time it was started and
+// starts a new one at path. The current file is only closed once the new
+// one is open; if that fails, the rename is undone and the handler keeps
+// writing to the current file. It must be called with h.mu held.
+func (h *rotatingFileHandler) rotate(now time.Time) error {
+	stamp := h.start.Format(backupTimeFormat)
+	backup := filepath.Join(h.dir, h.prefix+stamp+h.ext)
+	for i := 1; taken(backup); i++ {
+		backup = filepath.Join(h.dir, fmt.Sprintf("%s%s.%d%s", h.prefix, stamp, i, h.ext))
+	}
+	if err := os.Rename(h.path, backup); err != nil {
+		return err
+	}
+
+	old := h.file
+	if err := h.open(now); err != nil {
+		os.Rename(backup, h.path)
+		return err
+	}
+	liveFiles.remove(old)
+	old.Close()
+	h.triggerMill()
+	return nil
+}
+
+// open opens the file at path. It must be called with h.mu held or before
+// the handler is in use.
+func (h *rotatingFileHandler) open(now time.Time) error {
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	liveFiles.add(f, fi)
+	h.file = f
+	h.start = now
+	h.size = fi.Size()
+	if h.opts.Interval > 0 {
+		h.next = now.Truncate(h.opts.Interval).Add(h.opts.Interval)
+	}
+	return nil
+}
+
+// taken reports whether a file, compressed or not, already uses name.
+func taken(name string) bool {
+	for _, n := range []string{name, name + compressSuffix} {
+		if _, err := os.Lstat(n); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// link atomically points the symlink at path.
+func (h *rotatingFileHandler) link() error {
+	target := h.path
+	if filepath.Dir(h.opts.Symlink) == h.dir {
+		target = filepath.Base(h.path)
+	} else if abs, err := filepath.Abs(h.path); err == nil {
+		target = abs
+	}
+
+	tmp := h.opts.Symlink + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.opts.Symlink)
+}
+
+func (h *rotatingFileHandler) triggerMill() {
+	select {
+	case h.millCh <- struct{}{}:
+	default:
+	}
+}
+
+// mill compresses and removes old files whenever it is triggered.
+func (h *rotatingFileHandler) mill() {
+	defer close(h.done)
+	if h.hold != nil {
+		select {
+		case <-h.hold:
+		case <-h.quit:
+			return
+		}
+	}
+	for range h.millCh {
+		h.millOnce()
+	}
+}
+
+// liveFiles are the files open in rotating file handlers.
+var liveFiles = &openFiles{m: make(map[*os.File]os.FileInfo)}
+
+// openFiles is a set of open files which are recognized under any name.
+type openFiles struct {
+	mu sync.Mutex
+	m  map[*os.File]os.FileInfo
+}
+
+func (o *openFiles) add(f *os.File, fi os.FileInfo) {
+	o.mu.Lock()
+	o.m[f] = fi
+	o.mu.Unlock()
+}
+
+func (o *openFiles) remove(f *os.File) {
+	o.mu.Lock()
+	delete(o.m, f)
+	o.mu.Unlock()
+}
+
+// contains reports whether the file at name is open.
+func (o *openFiles) contains(name string) bool {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, open := range o.m {
+		if os.SameFile(fi, open) {
+			return true
+		}
+	}
+	return false
+}
+
+type backupFile struct {
+	name string
+	time time.Time
+	seq  int // the number added to names which were taken
+}
+
+func (h *rotatingFileHandler) millOnce() {
+	if !h.opts.Compress && h.opts.MaxBackups <= 0 && h.opts.MaxAge <= 0 {
+		return
+	}
+
+	backups, err := h.backups()
+	if err != nil {
+		return
+	}
+	// leave alone files which are still being written, by this handler or
+	// another one writing to the same path
+	files := backups[:0]
+	for _, b := range backups {
+		if !liveFiles.contains(filepath.Join(h.dir, b.name)) {
+			files = append(files, b)
+		}
+	}
+
+	var remove []backupFile
+	if h.opts.MaxBackups > 0 && len(files) > h.opts.MaxBackups {
+		remove = append(remove, files[h.opts.MaxBackups:]...)
+		files = files[:h.opts.MaxBackups]
+	}
+	if h.opts.MaxAge > 0 {
+		cutoff := h.now().Add(-h.opts.MaxAge)
+		kept := files[:0]
+		for _, f := range files {
+			if f.time.Before(cutoff) {
+				remove = append(remove, f)
+			} else {
+				kept = append(kept, f)
+			}
+		}
+		files = kept
+	}
+
+	for _, f := range remove {
+		os.Remove(filepath.Join(h.dir, f.name))
+	}
+
+	if h.opts.Compress {
+		for _, f := range files {
+			if !strings.HasSuffix(f.name, compressSuffix) {
+				compressFile(filepath.Join(h.dir, f.name))
+			}
+		}
+	}
+}
+
+// backups returns the files written by the handler, newest first.
+func (h *rotatingFileHandler) backups() ([]backupFile, error) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, h.prefix) {
+			continue
+		}
+		trimmed := strings.TrimSuffix(name, compressSuffix)
+		if !strings.HasSuffix(trimmed, h.ext) {
+			continue
+		}
+		stamp := trimmed[len(h.prefix):]
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		loc := time.UTC
+		if h.opts.LocalTime {
+			loc = time.Local
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp[:len(backupTimeFormat)], loc)
+		if err != nil {
+			continue
+		}
+		seq, _ := strconv.Atoi(strings.TrimPrefix(stamp[len(backupTimeFormat):len(stamp)-len(h.ext)], "."))
+		files = append(files, backupFile{name: name, time: t, seq: seq})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].time.Equal(files[j].time) {
+			return files[i].seq > files[j].seq
+		}
+		return files[i].time.After(files[j].time)
+	})
+	return files, nil
+}
+
+// compressFile gzips name into name.gz and removes name once the
+// compressed copy has been written completely.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + compressSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
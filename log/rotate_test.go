@@ -0,0 +1,281 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRotatingHandler returns a RotatingFileHandler writing lines to
+// app.log in dir, along with the handler doing the work.
+func newTestRotatingHandler(t *testing.T, dir string, opts RotateOptions) (Handler, *rotatingFileHandler) {
+	t.Helper()
+	h, err := RotatingFileHandler(filepath.Join(dir, "app.log"), lineFormat, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeHandler(h) })
+	return h, h.(*lazyHandler).h.(*rotatingFileHandler)
+}
+
+func rotateMessages(t *testing.T, h Handler, msgs ...string) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := h.Log(testRecord(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readLog returns the contents of a log file, decompressing it if needed.
+func readLog(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, compressSuffix) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// backupNames returns the names of the backups of rh, newest first.
+func backupNames(t *testing.T, rh *rotatingFileHandler) []string {
+	t.Helper()
+	backups, err := rh.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.name)
+	}
+	return names
+}
+
+func createFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRotatingFileHandlerSize(t *testing.T) {
+	dir := t.TempDir()
+	h, rh := newTestRotatingHandler(t, dir, RotateOptions{MaxSize: 10})
+
+	// every line has 5 bytes, so every file holds two of them
+	rotateMessages(t, h, "msg0", "msg1", "msg2", "msg3", "msg4")
+
+	names := backupNames(t, rh)
+	if len(names) != 2 {
+		t.Fatalf("got backups %q, want two", names)
+	}
+	for i, want := range []string{"msg2\nmsg3\n", "msg0\nmsg1\n"} {
+		if got := readLog(t, filepath.Join(dir, names[i])); got != want {
+			t.Errorf("%s: got %q, want %q", names[i], got, want)
+		}
+	}
+	if got := readLog(t, filepath.Join(dir, "app.log")); got != "msg4\n" {
+		t.Errorf("app.log: got %q", got)
+	}
+
+	// a line larger than MaxSize still goes into a file of its own
+	rotateMessages(t, h, strings.Repeat("x", 20))
+	if names := backupNames(t, rh); len(names) != 3 {
+		t.Errorf("got backups %q, want three", names)
+	}
+}
+
+func TestRotatingFileHandlerInterval(t *testing.T) {
+	dir := t.TempDir()
+	h, rh := newTestRotatingHandler(t, dir, RotateOptions{Interval: 50 * time.Millisecond})
+
+	rotateMessages(t, h, "first", "second")
+	rh.mu.Lock()
+	start, next := rh.start, rh.next
+	rh.mu.Unlock()
+	if next.Sub(start) > 50*time.Millisecond || next.Truncate(50*time.Millisecond) != next {
+		t.Fatalf("file started at %v is rotated at %v", start, next)
+	}
+
+	time.Sleep(time.Until(next) + 10*time.Millisecond)
+	rotateMessages(t, h, "third")
+
+	names := backupNames(t, rh)
+	if want := "app-" + start.Format(backupTimeFormat) + ".log"; len(names) != 1 || names[0] != want {
+		t.Fatalf("got backups %q, want %s", names, want)
+	}
+	if got := readLog(t, filepath.Join(dir, names[0])); got != "first\nsecond\n" {
+		t.Errorf("%s: got %q", names[0], got)
+	}
+	if got := readLog(t, filepath.Join(dir, "app.log")); got != "third\n" {
+		t.Errorf("app.log: got %q", got)
+	}
+}
+
+func TestRotatingFileHandlerNameCollisions(t *testing.T) {
+	dir := t.TempDir()
+	h, rh := newTestRotatingHandler(t, dir, RotateOptions{MaxSize: 1})
+
+	// every file is started at the same time, and a compressed backup
+	// already has the third name
+	start := time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	stamp := start.Format(backupTimeFormat)
+	createFiles(t, dir, "app-"+stamp+".2.log.gz")
+	for _, msg := range []string{"msg0", "msg1", "msg2", "msg3"} {
+		rh.mu.Lock()
+		rh.start = start
+		rh.mu.Unlock()
+		rotateMessages(t, h, msg)
+	}
+
+	want := []string{
+		"app-" + stamp + ".3.log",
+		"app-" + stamp + ".2.log.gz",
+		"app-" + stamp + ".1.log",
+		"app-" + stamp + ".log",
+	}
+	names := backupNames(t, rh)
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("got backups %q, want %q", names, want)
+	}
+	for i, msg := range []string{"msg2", "", "msg1", "msg0"} {
+		if msg == "" {
+			continue
+		}
+		if got := readLog(t, filepath.Join(dir, names[i])); got != msg+"\n" {
+			t.Errorf("%s: got %q, want %q", names[i], got, msg)
+		}
+	}
+}
+
+func TestRotatingFileHandlerPruning(t *testing.T) {
+	now := time.Now().UTC()
+	stamp := func(age time.Duration) string {
+		return "app-" + now.Add(-age).Format(backupTimeFormat)
+	}
+
+	for _, test := range []struct {
+		name string
+		opts RotateOptions
+		kept []string
+	}{{
+		// of two files started at the same time, the numbered one is newer
+		"MaxBackups", RotateOptions{MaxBackups: 1},
+		[]string{stamp(time.Hour) + ".1.log"},
+	}, {
+		"MaxAge", RotateOptions{MaxAge: 4 * time.Hour},
+		[]string{stamp(time.Hour) + ".1.log", stamp(time.Hour) + ".log", stamp(3*time.Hour) + ".log.gz"},
+	}, {
+		"Both", RotateOptions{MaxBackups: 3, MaxAge: 2 * time.Hour},
+		[]string{stamp(time.Hour) + ".1.log", stamp(time.Hour) + ".log"},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createFiles(t, dir,
+				stamp(5*time.Hour)+".log",
+				stamp(3*time.Hour)+".log.gz",
+				stamp(time.Hour)+".log",
+				stamp(time.Hour)+".1.log",
+				"app.txt",
+				"other-"+now.Format(backupTimeFormat)+".log",
+			)
+
+			// files are pruned when the handler is started, and Close
+			// waits for that
+			h, rh := newTestRotatingHandler(t, dir, test.opts)
+			if err := closeHandler(h); err != nil {
+				t.Fatal(err)
+			}
+
+			names := backupNames(t, rh)
+			if strings.Join(names, " ") != strings.Join(test.kept, " ") {
+				t.Errorf("got backups %q, want %q", names, test.kept)
+			}
+			for _, name := range []string{"app.log", "app.txt", "other-" + now.Format(backupTimeFormat) + ".log"} {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileHandlerCompress(t *testing.T) {
+	dir := t.TempDir()
+	h, rh := newTestRotatingHandler(t, dir, RotateOptions{MaxSize: 10, Compress: true})
+	rotateMessages(t, h, "msg0", "msg1", "msg2", "msg3", "msg4")
+	if err := closeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+
+	names := backupNames(t, rh)
+	if len(names) != 2 {
+		t.Fatalf("got backups %q, want two", names)
+	}
+	for i, want := range []string{"msg2\nmsg3\n", "msg0\nmsg1\n"} {
+		if !strings.HasSuffix(names[i], ".log"+compressSuffix) {
+			t.Errorf("%s is not compressed", names[i])
+			continue
+		}
+		if got := readLog(t, filepath.Join(dir, names[i])); got != want {
+			t.Errorf("%s: got %q, want %q", names[i], got, want)
+		}
+	}
+	if got := readLog(t, filepath.Join(dir, "app.log")); got != "msg4\n" {
+		t.Errorf("app.log: got %q", got)
+	}
+}
+
+func TestRotatingFileHandlerLiveFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// another handler writes to a file which looks like a backup of
+	// app.log, as it does while a configuration is reloaded
+	live := "app-" + time.Now().UTC().Format(backupTimeFormat) + ".log"
+	other, err := RotatingFileHandler(filepath.Join(dir, live), lineFormat, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(other)
+	rotateMessages(t, other, "live")
+
+	h, _ := newTestRotatingHandler(t, dir, RotateOptions{Compress: true})
+	if err := closeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLog(t, filepath.Join(dir, live)); got != "live\n" {
+		t.Errorf("live file: got %q", got)
+	}
+
+	// once it is closed, it is an ordinary backup
+	if err := closeHandler(other); err != nil {
+		t.Fatal(err)
+	}
+	h, rh := newTestRotatingHandler(t, dir, RotateOptions{Compress: true})
+	if err := closeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	names := backupNames(t, rh)
+	if len(names) != 1 || names[0] != live+compressSuffix {
+		t.Errorf("got backups %q, want %s", names, live+compressSuffix)
+	}
+}
@@ -0,0 +1,186 @@
+package log
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-stack/stack"
+)
+
+const defaultSamplingInterval = time.Second
+
+// SamplingOptions configures a SamplingHandler.
+type SamplingOptions struct {
+	// Interval is the length of a sampling window. Defaults to 1 second.
+	Interval time.Duration
+
+	// First is the number of records per window that are always written.
+	First int
+
+	// Thereafter writes every Thereafter-th record after the first First
+	// records of a window. If it is zero, those records are all dropped.
+	Thereafter int
+
+	// ByCaller samples records per call site instead of per level and
+	// message.
+	ByCaller bool
+}
+
+// SamplingHandler returns a handler which limits the records written to h
+// from high-volume log sites. Records are grouped by level and message, or
+// by call site if opts.ByCaller is set. Of each group, the first
+// opts.First records of every opts.Interval are written, then only every
+// opts.Thereafter-th.
+//
+// When a window with dropped records ends, a summary record of the same
+// level with the message "log records suppressed by sampling" is written
+// to h. It holds the number of dropped records under the key "suppressed"
+// and the last dropped message under "sampled_msg". Pending summaries are
+// also written when the handler is flushed or closed.
+func SamplingHandler(h Handler, opts SamplingOptions) Handler {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultSamplingInterval
+	}
+	return &samplingHandler{
+		h:       h,
+		opts:    opts,
+		samples: make(map[sampleKey]*sample),
+	}
+}
+
+type sampleKey struct {
+	level LEVEL
+	msg   string
+	pc    uintptr
+}
+
+// sample counts the records of one group in the current window.
+type sample struct {
+	start      time.Time
+	n          int
+	suppressed int
+
+	// level, msg and call of the last suppressed record, for the summary
+	level LEVEL
+	msg   string
+	call  stack.Call
+}
+
+type samplingHandler struct {
+	h    Handler
+	opts SamplingOptions
+
+	mu        sync.Mutex
+	samples   map[sampleKey]*sample
+	lastSweep time.Time
+}
+
+func (s *samplingHandler) Log(r *Record) error {
+	now := time.Now()
+
+	var key sampleKey
+	if s.opts.ByCaller {
+		key.pc = r.Call.Frame().PC
+	} else {
+		key.level, key.msg = r.Level, r.Message
+	}
+
+	s.mu.Lock()
+	var summaries []*Record
+	if now.Sub(s.lastSweep) >= s.opts.Interval {
+		summaries = s.sweep(now, false)
+		s.lastSweep = now
+	}
+
+	sm, ok := s.samples[key]
+	if !ok {
+		sm = &sample{start: now}
+		s.samples[key] = sm
+	} else if now.Sub(sm.start) >= s.opts.Interval {
+		if sr := sm.summary(now, s.opts.ByCaller); sr != nil {
+			summaries = append(summaries, sr)
+		}
+		*sm = sample{start: now}
+	}
+
+	sm.n++
+	pass := sm.n <= s.opts.First ||
+		s.opts.Thereafter > 0 && (sm.n-s.opts.First)%s.opts.Thereafter == 0
+	if !pass {
+		sm.suppressed++
+		sm.level, sm.msg, sm.call = r.Level, r.Message, r.Call
+	}
+	s.mu.Unlock()
+
+	for _, sr := range summaries {
+		s.h.Log(sr)
+	}
+	if !pass {
+		return nil
+	}
+	return s.h.Log(r)
+}
+
+func (s *samplingHandler) Flush() error {
+	s.writeSummaries()
+	return flushHandler(s.h)
+}
+
+func (s *samplingHandler) Close() error {
+	s.writeSummaries()
+	return closeHandler(s.h)
+}
+
+// writeSummaries writes the summaries of all windows, ended or not.
+func (s *samplingHandler) writeSummaries() {
+	s.mu.Lock()
+	summaries := s.sweep(time.Now(), true)
+	s.mu.Unlock()
+
+	for _, sr := range summaries {
+		s.h.Log(sr)
+	}
+}
+
+// sweep returns the summaries of the windows which have ended, or of all
+// windows if all is set, and forgets about those groups so that the map
+// doesn't grow with every message ever logged. It must be called with
+// s.mu held.
+func (s *samplingHandler) sweep(now time.Time, all bool) []*Record {
+	var summaries []*Record
+	for key, sm := range s.samples {
+		if !all && now.Sub(sm.start) < s.opts.Interval {
+			continue
+		}
+		if sr := sm.summary(now, s.opts.ByCaller); sr != nil {
+			summaries = append(summaries, sr)
+		}
+		if all {
+			// keep counting the current window
+			sm.suppressed = 0
+			continue
+		}
+		delete(s.samples, key)
+	}
+	return summaries
+}
+
+// summary returns the record reporting the suppressed records of the
+// window, or nil if none were suppressed.
+func (sm *sample) summary(now time.Time, byCaller bool) *Record {
+	if sm.suppressed == 0 {
+		return nil
+	}
+	ctx := []interface{}{"suppressed", sm.suppressed, "sampled_msg", sm.msg}
+	if byCaller {
+		ctx = append(ctx, "caller", sm.call)
+	}
+	return &Record{
+		Time:     now,
+		Level:    sm.level,
+		Message:  "log records suppressed by sampling",
+		Context:  ctx,
+		Call:     sm.call,
+		KeyNames: defaultKeyNames,
+	}
+}
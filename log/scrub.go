@@ -0,0 +1,252 @@
+package log
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Detector selects built-in patterns of ScrubHandler.
+type Detector uint
+
+// List of built-in detectors
+const (
+	// DetectEmail replaces e-mail addresses with "[EMAIL]".
+	DetectEmail Detector = 1 << iota
+	// DetectCreditCard replaces card numbers passing the Luhn check with "[CREDIT_CARD]".
+	DetectCreditCard
+	// DetectIP replaces IPv4 and IPv6 addresses with "[IP]".
+	DetectIP
+	// DetectJWT replaces JSON Web Tokens with "[JWT]".
+	DetectJWT
+	// DetectAWSKey replaces AWS access key IDs with "[AWS_KEY]".
+	DetectAWSKey
+
+	// DetectAll enables every built-in detector.
+	DetectAll = DetectEmail | DetectCreditCard | DetectIP | DetectJWT | DetectAWSKey
+)
+
+// A ScrubRule replaces the matches of a regular expression.
+type ScrubRule struct {
+	// Pattern is the expression to look for.
+	Pattern *regexp.Regexp
+
+	// Replacement replaces every accepted match.
+	Replacement string
+
+	// Validate, if set, is called for every match and the match is only
+	// replaced if it returns true.
+	Validate func(match string) bool
+
+	// hint is a substring every match contains, used to skip the
+	// expression for strings which can't match.
+	hint string
+
+	// suffix, if set, is removed from matches which aren't accepted as
+	// they are, and the rest is validated again. The suffix is kept.
+	suffix string
+}
+
+// ScrubOptions configures a ScrubHandler.
+type ScrubOptions struct {
+	// Detectors enables built-in detectors, e.g. DetectAll.
+	Detectors Detector
+
+	// Rules are applied after the built-in detectors.
+	Rules []ScrubRule
+}
+
+var (
+	emailRule = ScrubRule{
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Replacement: "[EMAIL]",
+		hint:        "@",
+	}
+	creditCardRule = ScrubRule{
+		Pattern:     regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Replacement: "[CREDIT_CARD]",
+		Validate:    luhn,
+	}
+	ipv6Rule = ScrubRule{
+		Pattern:     regexp.MustCompile(`[0-9A-Fa-f:]*:[0-9A-Fa-f]*:[0-9A-Fa-f:.]*`),
+		Replacement: "[IP]",
+		Validate:    func(s string) bool { return net.ParseIP(s) != nil },
+		hint:        ":",
+		suffix:      ":", // as in "dial fe80::1: connection refused"
+	}
+	ipv4Rule = ScrubRule{
+		Pattern:     regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		Replacement: "[IP]",
+		Validate:    func(s string) bool { return net.ParseIP(s) != nil },
+		hint:        ".",
+	}
+	jwtRule = ScrubRule{
+		Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		Replacement: "[JWT]",
+		hint:        "eyJ",
+	}
+	awsKeyRule = ScrubRule{
+		Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA|APKA|ASCA)[A-Z0-9]{16}\b`),
+		Replacement: "[AWS_KEY]",
+	}
+)
+
+// ScrubHandler returns a handler which replaces secrets and personal data
+// found in the message, string and error values of records before writing
+// them to h. Built-in detectors are enabled with opts.Detectors and custom
+// expressions are added with opts.Rules. Unlike RedactHandler, which masks
+// values by key, ScrubHandler finds data embedded in free text.
+//
+// The record passed to h is a copy, the values logged by the caller are
+// never modified.
+func ScrubHandler(h Handler, opts ScrubOptions) Handler {
+	s := &scrubHandler{h: h}
+
+	// tokens first, they could contain parts matching the other rules
+	if opts.Detectors&DetectJWT != 0 {
+		s.rules = append(s.rules, jwtRule)
+	}
+	if opts.Detectors&DetectAWSKey != 0 {
+		s.rules = append(s.rules, awsKeyRule)
+	}
+	if opts.Detectors&DetectEmail != 0 {
+		s.rules = append(s.rules, emailRule)
+	}
+	if opts.Detectors&DetectCreditCard != 0 {
+		s.rules = append(s.rules, creditCardRule)
+	}
+	if opts.Detectors&DetectIP != 0 {
+		s.rules = append(s.rules, ipv6Rule, ipv4Rule)
+	}
+	s.rules = append(s.rules, opts.Rules...)
+	return s
+}
+
+type scrubHandler struct {
+	h     Handler
+	rules []ScrubRule
+}
+
+func (s *scrubHandler) Log(r *Record) error {
+	msg := s.scrub(r.Message)
+
+	var ctx []interface{}
+	for i := 1; i < len(r.Context); i += 2 {
+		v, changed := s.value(r.Context[i])
+		if !changed {
+			continue
+		}
+		if ctx == nil {
+			ctx = make([]interface{}, len(r.Context))
+			copy(ctx, r.Context)
+		}
+		ctx[i] = v
+	}
+
+	var fields []Field
+	for i, f := range r.Fields {
+		var v interface{}
+		changed := false
+		switch f.Type {
+		case StringType, ErrorType, AnyType:
+			v, changed = s.value(f.Value())
+		}
+		if !changed {
+			continue
+		}
+		if fields == nil {
+			fields = make([]Field, len(r.Fields))
+			copy(fields, r.Fields)
+		}
+		fields[i] = String(f.Key, v.(string))
+	}
+
+	if msg == r.Message && ctx == nil && fields == nil {
+		return s.h.Log(r)
+	}
+
+	nr := *r
+	nr.Message = msg
+	if ctx != nil {
+		nr.Context = ctx
+	}
+	if fields != nil {
+		nr.Fields = fields
+	}
+	return s.h.Log(&nr)
+}
+
+func (s *scrubHandler) Flush() error {
+	return flushHandler(s.h)
+}
+
+func (s *scrubHandler) Close() error {
+	return closeHandler(s.h)
+}
+
+// value scrubs strings and error messages. The second result is false if
+// v is returned unchanged.
+func (s *scrubHandler) value(v interface{}) (interface{}, bool) {
+	var str string
+	switch val := v.(type) {
+	case string:
+		str = val
+	case error:
+		if val == nil {
+			return v, false
+		}
+		str = val.Error()
+	default:
+		return v, false
+	}
+
+	scrubbed := s.scrub(str)
+	if scrubbed == str {
+		return v, false
+	}
+	return scrubbed, true
+}
+
+func (s *scrubHandler) scrub(str string) string {
+	for _, rule := range s.rules {
+		if rule.hint != "" && !strings.Contains(str, rule.hint) {
+			continue
+		}
+		if rule.Validate == nil {
+			str = rule.Pattern.ReplaceAllLiteralString(str, rule.Replacement)
+			continue
+		}
+		str = rule.Pattern.ReplaceAllStringFunc(str, func(m string) string {
+			if rule.Validate(m) {
+				return rule.Replacement
+			}
+			if t := strings.TrimSuffix(m, rule.suffix); rule.suffix != "" && t != m && rule.Validate(t) {
+				return rule.Replacement + rule.suffix
+			}
+			return m
+		})
+	}
+	return str
+}
+
+// luhn reports whether the digits in s form a 13 to 19 digit number with a
+// valid Luhn check digit.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
@@ -0,0 +1,334 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/techarm/toolkit/request"
+)
+
+const (
+	defaultShipBatchCount = 1000
+	defaultShipBatchBytes = 1 << 20
+	defaultShipInterval   = time.Second
+	defaultShipQueueSize  = 8
+	defaultShipRetries    = 5
+	defaultShipMinBackoff = 500 * time.Millisecond
+	defaultShipMaxBackoff = 30 * time.Second
+)
+
+var errShipQueueFull = errors.New("log: batch queue is full")
+
+// A BatchEncoder encodes records into the request bodies sent by an
+// HTTPHandler.
+type BatchEncoder interface {
+	// EncodeRecord encodes a single record as an entry of a batch. It is
+	// called when the record is logged.
+	EncodeRecord(r *Record) ([]byte, error)
+
+	// EncodeBatch builds a request body from the entries of a batch.
+	EncodeBatch(entries [][]byte) []byte
+
+	// ContentType is the content type of the request bodies.
+	ContentType() string
+}
+
+// HTTPOptions configures an HTTPHandler.
+type HTTPOptions struct {
+	// Encoder encodes the batches. It is required.
+	Encoder BatchEncoder
+
+	// Client sends the requests. Its Header is sent with every request,
+	// which is where credentials such as the "Authorization" header go.
+	// Defaults to request.NewClient().
+	Client *request.Client
+
+	// Method is the request method, "POST" by default.
+	Method request.Method
+
+	// BatchCount and BatchBytes limit the number of records and the
+	// encoded size of a batch. They default to 1000 records and 1 MiB.
+	BatchCount int
+	BatchBytes int
+
+	// FlushInterval is the longest time a record waits for its batch to
+	// fill up. Defaults to 1 second.
+	FlushInterval time.Duration
+
+	// Compress gzips the request bodies.
+	Compress bool
+
+	// QueueSize is the number of full batches which may wait to be sent.
+	// Batches beyond that are dropped. Defaults to 8.
+	QueueSize int
+
+	// MaxRetries is the number of times a batch is resent after network
+	// errors, 429 and 5xx responses, waiting between MinBackoff and
+	// MaxBackoff with exponential backoff. Defaults to 5 retries waiting
+	// between 500 milliseconds and 30 seconds. A negative MaxRetries
+	// disables retries.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnError, if set, is called with the number of records lost whenever
+	// a batch is dropped.
+	OnError func(err error, records int)
+}
+
+// HTTPHandler returns a handler which sends log records to url in batches,
+// encoded by opts.Encoder, such as LokiEncoder, ElasticsearchEncoder or
+// SplunkHECEncoder. A batch is sent when it reaches opts.BatchCount records
+// or opts.BatchBytes bytes, or opts.FlushInterval after its first record,
+// from a background goroutine.
+//
+// Flushing the handler sends the pending records and waits until every
+// batch has been sent or dropped. Closing it sends the pending records and
+// stops the goroutine; batches are no longer retried once the handler is
+// being closed.
+func HTTPHandler(url string, opts HTTPOptions) (Handler, error) {
+	if opts.Encoder == nil {
+		return nil, errors.New("log: HTTPOptions.Encoder is required")
+	}
+	if opts.Client == nil {
+		opts.Client = request.NewClient()
+	}
+	if opts.Method == "" {
+		opts.Method = request.MethodPost
+	}
+	if opts.BatchCount <= 0 {
+		opts.BatchCount = defaultShipBatchCount
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = defaultShipBatchBytes
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultShipInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultShipQueueSize
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultShipRetries
+	}
+	backoffDefaults(&opts.MinBackoff, &opts.MaxBackoff, defaultShipMinBackoff, defaultShipMaxBackoff)
+
+	h := &httpHandler{
+		url:   url,
+		opts:  opts,
+		queue: make(chan shipItem, opts.QueueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go h.run()
+	return LazyHandler(h), nil
+}
+
+// shipItem is either a batch to send or, if flushed is set, a marker which
+// is signalled once every earlier batch has been handled.
+type shipItem struct {
+	entries [][]byte
+	flushed chan struct{}
+}
+
+type httpHandler struct {
+	url   string
+	opts  HTTPOptions
+	queue chan shipItem
+	quit  chan struct{} // closed when Close is called
+	done  chan struct{}
+
+	// mu guards the current batch and closed. It is never held while
+	// waiting for room in the queue.
+	mu      sync.Mutex
+	entries [][]byte
+	size    int
+	timer   *time.Timer
+	closed  bool
+
+	// senders counts the Flush calls waiting for room in the queue, which
+	// Close waits for before it closes the queue
+	senders sync.WaitGroup
+}
+
+func (h *httpHandler) Log(r *Record) error {
+	entry, err := h.opts.Encoder.EncodeRecord(r)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return errHandlerClosed
+	}
+	dropped := 0
+	if len(h.entries) > 0 && h.size+len(entry) > h.opts.BatchBytes {
+		dropped += h.cut()
+	}
+	h.entries = append(h.entries, entry)
+	h.size += len(entry)
+
+	if len(h.entries) >= h.opts.BatchCount || h.size >= h.opts.BatchBytes {
+		dropped += h.cut()
+	} else if h.timer == nil {
+		h.timer = time.AfterFunc(h.opts.FlushInterval, h.expire)
+	}
+	h.mu.Unlock()
+
+	if dropped > 0 {
+		h.dropped(errShipQueueFull, dropped)
+	}
+	return nil
+}
+
+// expire queues the current batch once it has waited for FlushInterval.
+func (h *httpHandler) expire() {
+	h.mu.Lock()
+	h.timer = nil
+	dropped := 0
+	if !h.closed {
+		dropped = h.cut()
+	}
+	h.mu.Unlock()
+
+	if dropped > 0 {
+		h.dropped(errShipQueueFull, dropped)
+	}
+}
+
+func (h *httpHandler) Flush() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	entries := h.take()
+	h.senders.Add(1)
+	h.mu.Unlock()
+
+	if len(entries) > 0 {
+		h.queue <- shipItem{entries: entries}
+	}
+	flushed := make(chan struct{})
+	h.queue <- shipItem{flushed: flushed}
+	h.senders.Done()
+
+	<-flushed
+	return nil
+}
+
+func (h *httpHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	entries := h.take()
+	h.mu.Unlock()
+
+	close(h.quit)
+	if len(entries) > 0 {
+		h.queue <- shipItem{entries: entries}
+	}
+	h.senders.Wait()
+	close(h.queue)
+
+	<-h.done
+	return nil
+}
+
+// take removes the current batch and returns its entries. It must be
+// called with h.mu held.
+func (h *httpHandler) take() [][]byte {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	entries := h.entries
+	h.entries, h.size = nil, 0
+	return entries
+}
+
+// cut queues the current batch, dropping it if the queue is full, and
+// returns the number of records dropped. The caller reports them once it
+// has released h.mu, which it must hold.
+func (h *httpHandler) cut() int {
+	entries := h.take()
+	if len(entries) == 0 {
+		return 0
+	}
+	select {
+	case h.queue <- shipItem{entries: entries}:
+		return 0
+	default:
+		return len(entries)
+	}
+}
+
+func (h *httpHandler) run() {
+	defer close(h.done)
+	for item := range h.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		if err := h.send(item.entries); err != nil {
+			h.dropped(err, len(item.entries))
+		}
+	}
+}
+
+// send sends a batch, retrying as configured.
+func (h *httpHandler) send(entries [][]byte) error {
+	body := h.opts.Encoder.EncodeBatch(entries)
+
+	header := h.opts.Client.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Type", h.opts.Encoder.ContentType())
+	if h.opts.Compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	backoff := h.opts.MinBackoff
+	for attempt := 0; ; attempt++ {
+		status, resp, err := h.opts.Client.ExecuteRaw(h.url, h.opts.Method, bytes.NewReader(body), header)
+		if err == nil && status >= 200 && status < 300 {
+			return nil
+		}
+
+		retry := err != nil || status == http.StatusTooManyRequests || status >= 500
+		if err == nil {
+			err = fmt.Errorf("log: %s %s: %d %s", h.opts.Method, h.url, status, bytes.TrimSpace(resp))
+		}
+		if !retry || attempt >= h.opts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoffDelay(backoff)):
+		case <-h.quit:
+			return err
+		}
+		backoff = nextBackoff(backoff, h.opts.MaxBackoff)
+	}
+}
+
+func (h *httpHandler) dropped(err error, records int) {
+	if h.opts.OnError != nil {
+		h.opts.OnError(err, records)
+	}
+}
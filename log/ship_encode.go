@@ -0,0 +1,193 @@
+package log
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// LokiEncoder returns a BatchEncoder for the Grafana Loki push API,
+// usually at "http://loki:3100/loki/api/v1/push". Records are written as
+// lines formatted with fmtr, logfmt if it is nil, to the stream with the
+// given labels plus the label "level" and, for named loggers, "logger".
+func LokiEncoder(labels map[string]string, fmtr Format) BatchEncoder {
+	if fmtr == nil {
+		fmtr = LogfmtFormat()
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &lokiEncoder{labels: labels, keys: keys, fmtr: fmtr}
+}
+
+type lokiEncoder struct {
+	labels map[string]string
+	keys   []string
+	fmtr   Format
+}
+
+// EncodeRecord encodes r as the JSON object of its stream labels and the
+// JSON array of its timestamp and line, separated by a zero byte, so that
+// EncodeBatch can group the entries by stream.
+func (e *lokiEncoder) EncodeRecord(r *Record) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range e.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		appendJSONString(buf, k)
+		buf.WriteByte(':')
+		appendJSONString(buf, e.labels[k])
+	}
+	if len(e.keys) > 0 {
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"level":`)
+	appendJSONString(buf, r.Level.String())
+	if r.Name != "" {
+		buf.WriteString(`,"logger":`)
+		appendJSONString(buf, r.Name)
+	}
+	buf.WriteString("}\x00[\"")
+	buf.WriteString(strconv.FormatInt(r.Time.UnixNano(), 10))
+	buf.WriteString(`",`)
+	appendJSONString(buf, string(bytes.TrimSuffix(e.fmtr.Format(r), []byte{'\n'})))
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+func (e *lokiEncoder) EncodeBatch(entries [][]byte) []byte {
+	var order []string
+	streams := make(map[string][][]byte)
+	for _, entry := range entries {
+		i := bytes.IndexByte(entry, 0)
+		labels := string(entry[:i])
+		if _, ok := streams[labels]; !ok {
+			order = append(order, labels)
+		}
+		streams[labels] = append(streams[labels], entry[i+1:])
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"streams":[`)
+	for i, labels := range order {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`{"stream":`)
+		buf.WriteString(labels)
+		buf.WriteString(`,"values":[`)
+		for j, value := range streams[labels] {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(value)
+		}
+		buf.WriteString("]}")
+	}
+	buf.WriteString("]}")
+	return buf.Bytes()
+}
+
+func (e *lokiEncoder) ContentType() string {
+	return "application/json"
+}
+
+// ecsKeyNames are the key names of documents sent to Elasticsearch.
+var ecsKeyNames = RecordKeyNames{
+	Time:    "@timestamp",
+	Message: "message",
+	Level:   "level",
+	Name:    nameKey,
+}
+
+// ElasticsearchEncoder returns a BatchEncoder for the Elasticsearch bulk
+// API, usually at "http://elasticsearch:9200/_bulk". Every record is
+// created as a JSON document in index, with its time, message and level
+// under "@timestamp", "message" and "level".
+//
+// Elasticsearch reports failures of single documents in the response of a
+// successful request; those are not detected.
+func ElasticsearchEncoder(index string) BatchEncoder {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"create":{"_index":`)
+	appendJSONString(buf, index)
+	buf.WriteString("}}\n")
+	return &elasticsearchEncoder{action: buf.Bytes()}
+}
+
+type elasticsearchEncoder struct {
+	action []byte
+}
+
+func (e *elasticsearchEncoder) EncodeRecord(r *Record) ([]byte, error) {
+	doc := *r
+	doc.KeyNames = ecsKeyNames
+	return append(append([]byte{}, e.action...), jsonRecord(&doc, true)...), nil
+}
+
+func (e *elasticsearchEncoder) EncodeBatch(entries [][]byte) []byte {
+	return bytes.Join(entries, nil)
+}
+
+func (e *elasticsearchEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+// SplunkOptions sets the metadata of the events sent to Splunk. Empty
+// fields are left to the defaults of the HEC token.
+type SplunkOptions struct {
+	Index      string
+	Source     string
+	SourceType string
+	Host       string
+}
+
+// SplunkHECEncoder returns a BatchEncoder for the Splunk HTTP Event
+// Collector, usually at "https://splunk:8088/services/collector/event".
+// Records are sent as JSON events. The token is passed in the
+// "Authorization: Splunk <token>" header of the request.Client.
+func SplunkHECEncoder(opts SplunkOptions) BatchEncoder {
+	buf := &bytes.Buffer{}
+	for _, kv := range [][2]string{
+		{"index", opts.Index},
+		{"source", opts.Source},
+		{"sourcetype", opts.SourceType},
+		{"host", opts.Host},
+	} {
+		if kv[1] == "" {
+			continue
+		}
+		buf.WriteByte(',')
+		appendJSONString(buf, kv[0])
+		buf.WriteByte(':')
+		appendJSONString(buf, kv[1])
+	}
+	return &splunkEncoder{meta: buf.Bytes()}
+}
+
+type splunkEncoder struct {
+	meta []byte
+}
+
+func (e *splunkEncoder) EncodeRecord(r *Record) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"time":`)
+	buf.WriteString(strconv.FormatFloat(float64(r.Time.UnixNano())/1e9, 'f', 3, 64))
+	buf.Write(e.meta)
+	buf.WriteString(`,"event":`)
+	buf.Write(jsonRecord(r, false))
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+func (e *splunkEncoder) EncodeBatch(entries [][]byte) []byte {
+	return bytes.Join(entries, nil)
+}
+
+func (e *splunkEncoder) ContentType() string {
+	return "application/json"
+}
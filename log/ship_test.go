@@ -0,0 +1,344 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineEncoder encodes a batch as the messages of its records, one per
+// line.
+type lineEncoder struct{}
+
+func (lineEncoder) EncodeRecord(r *Record) ([]byte, error) {
+	return []byte(r.Message), nil
+}
+
+func (lineEncoder) EncodeBatch(entries [][]byte) []byte {
+	var b []byte
+	for _, e := range entries {
+		b = append(append(b, e...), '\n')
+	}
+	return b
+}
+
+func (lineEncoder) ContentType() string {
+	return "text/plain"
+}
+
+// shipServer is an HTTP server which answers the requests of an
+// HTTPHandler with the status returned by status, and sends the batches it
+// accepts on a channel.
+type shipServer struct {
+	*httptest.Server
+	batches chan []string
+
+	mu       sync.Mutex
+	requests int
+	status   func(n int) int // the status of the nth request, 1 based
+	gzipped  []bool
+}
+
+func newShipServer(t *testing.T, status func(n int) int) *shipServer {
+	s := &shipServer{batches: make(chan []string, 16), status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *shipServer) serve(w http.ResponseWriter, req *http.Request) {
+	var body io.Reader = req.Body
+	gzipped := req.Header.Get("Content-Encoding") == "gzip"
+	if gzipped {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	status := http.StatusNoContent
+	if s.status != nil {
+		status = s.status(s.requests)
+	}
+	s.gzipped = append(s.gzipped, gzipped)
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+	if status < 300 {
+		s.batches <- strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+}
+
+func (s *shipServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// batch waits for the next batch accepted by the server.
+func (s *shipServer) batch(t *testing.T) []string {
+	t.Helper()
+	select {
+	case b := <-s.batches:
+		return b
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch")
+		return nil
+	}
+}
+
+// noBatch checks that no batch is accepted within d.
+func (s *shipServer) noBatch(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case b := <-s.batches:
+		t.Fatalf("unexpected batch %q", b)
+	case <-time.After(d):
+	}
+}
+
+func newTestHTTPHandler(t *testing.T, url string, opts HTTPOptions) Handler {
+	t.Helper()
+	opts.Encoder = lineEncoder{}
+	h, err := HTTPHandler(url, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeHandler(h) })
+	return h
+}
+
+func logMessages(h Handler, msgs ...string) {
+	for _, msg := range msgs {
+		h.Log(testRecord(msg))
+	}
+}
+
+func TestHTTPHandlerBatchCount(t *testing.T) {
+	s := newShipServer(t, nil)
+	h := newTestHTTPHandler(t, s.URL, HTTPOptions{BatchCount: 3, FlushInterval: time.Hour})
+
+	logMessages(h, "1", "2", "3", "4", "5", "6", "7")
+	for _, want := range []string{"1 2 3", "4 5 6"} {
+		if got := strings.Join(s.batch(t), " "); got != want {
+			t.Errorf("got batch %q, want %q", got, want)
+		}
+	}
+	s.noBatch(t, 20*time.Millisecond)
+
+	if err := flushHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.batch(t), " "); got != "7" {
+		t.Errorf("got batch %q after Flush, want %q", got, "7")
+	}
+}
+
+func TestHTTPHandlerBatchBytes(t *testing.T) {
+	s := newShipServer(t, nil)
+	h := newTestHTTPHandler(t, s.URL, HTTPOptions{BatchBytes: 10, FlushInterval: time.Hour})
+
+	// the third record doesn't fit into the batch anymore and starts a new
+	// one, the fourth fills that one up
+	logMessages(h, "aaaa", "bbbb", "cccc", "dddddd", "e")
+	for _, want := range []string{"aaaa bbbb", "cccc dddddd"} {
+		if got := strings.Join(s.batch(t), " "); got != want {
+			t.Errorf("got batch %q, want %q", got, want)
+		}
+	}
+	s.noBatch(t, 20*time.Millisecond)
+}
+
+func TestHTTPHandlerFlushInterval(t *testing.T) {
+	s := newShipServer(t, nil)
+	h := newTestHTTPHandler(t, s.URL, HTTPOptions{FlushInterval: 20 * time.Millisecond})
+
+	start := time.Now()
+	logMessages(h, "1", "2")
+	if got := strings.Join(s.batch(t), " "); got != "1 2" {
+		t.Errorf("got batch %q, want %q", got, "1 2")
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("batch was sent after %v, before the flush interval", d)
+	}
+}
+
+func TestHTTPHandlerRetries(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		status   func(n int) int
+		requests int
+		lost     bool
+	}{
+		{"Recovered", func(n int) int {
+			if n < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		}, 3, false},
+		{"TooManyRequests", func(n int) int {
+			if n == 1 {
+				return http.StatusTooManyRequests
+			}
+			return http.StatusOK
+		}, 2, false},
+		{"Exhausted", func(int) int { return http.StatusBadGateway }, 3, true},
+		{"ClientError", func(int) int { return http.StatusBadRequest }, 1, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := newShipServer(t, test.status)
+
+			var mu sync.Mutex
+			var lost int
+			var lostErr error
+			h := newTestHTTPHandler(t, s.URL, HTTPOptions{
+				MaxRetries: 2,
+				MinBackoff: time.Millisecond,
+				MaxBackoff: 2 * time.Millisecond,
+				OnError: func(err error, records int) {
+					mu.Lock()
+					lost, lostErr = lost+records, err
+					mu.Unlock()
+				},
+			})
+
+			logMessages(h, "1", "2")
+			if err := flushHandler(h); err != nil {
+				t.Fatal(err)
+			}
+			if n := s.requestCount(); n != test.requests {
+				t.Errorf("got %d requests, want %d", n, test.requests)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if test.lost {
+				if lost != 2 || lostErr == nil {
+					t.Errorf("OnError reported %d records lost with %v, want 2", lost, lostErr)
+				}
+			} else {
+				if lost != 0 {
+					t.Errorf("OnError reported %d records lost with %v", lost, lostErr)
+				}
+				if got := strings.Join(s.batch(t), " "); got != "1 2" {
+					t.Errorf("got batch %q, want %q", got, "1 2")
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerGzip(t *testing.T) {
+	s := newShipServer(t, nil)
+	h := newTestHTTPHandler(t, s.URL, HTTPOptions{Compress: true})
+
+	logMessages(h, "compressed", "batch")
+	flushHandler(h)
+	if got := strings.Join(s.batch(t), " "); got != "compressed batch" {
+		t.Errorf("got batch %q, want %q", got, "compressed batch")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.gzipped) != 1 || !s.gzipped[0] {
+		t.Errorf("request was not gzipped")
+	}
+}
+
+func TestHTTPHandlerQueueFull(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	s := &shipServer{batches: make(chan []string, 16)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		s.serve(w, req)
+	}))
+	defer s.Close()
+
+	var mu sync.Mutex
+	var lost int
+	h := newTestHTTPHandler(t, s.URL, HTTPOptions{
+		BatchCount: 1,
+		QueueSize:  1,
+		OnError: func(err error, records int) {
+			if err != errShipQueueFull {
+				t.Errorf("OnError called with %v", err)
+			}
+			mu.Lock()
+			lost += records
+			mu.Unlock()
+		},
+	})
+
+	// while the first batch is being sent and the second one waits in the
+	// queue, the next ones are dropped
+	logMessages(h, "1")
+	<-started
+	logMessages(h, "2", "3", "4")
+	close(release)
+	flushHandler(h)
+
+	for _, want := range []string{"1", "2"} {
+		if got := strings.Join(s.batch(t), " "); got != want {
+			t.Errorf("got batch %q, want %q", got, want)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if lost != 2 {
+		t.Errorf("OnError reported %d records lost, want 2", lost)
+	}
+}
+
+func TestHTTPHandlerClose(t *testing.T) {
+	s := newShipServer(t, func(int) int { return http.StatusServiceUnavailable })
+
+	lost := make(chan int, 1)
+	var h Handler
+	h, err := HTTPHandler(s.URL, HTTPOptions{
+		Encoder:    lineEncoder{},
+		MinBackoff: time.Hour,
+		OnError: func(err error, records int) {
+			lost <- records
+			// logging from OnError must not deadlock, even while closing
+			h.Log(testRecord("lost"))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logMessages(h, "1", "2")
+	closed := make(chan error)
+	go func() { closed <- closeHandler(h) }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the retries")
+	}
+	if n := <-lost; n != 2 {
+		t.Errorf("OnError reported %d records lost, want 2", n)
+	}
+	if err := h.Log(testRecord("closed")); err != errHandlerClosed {
+		t.Errorf("Log after Close returned %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/go-stack/stack"
+)
+
+// SlogOptions configures the slog.Handler returned by SlogAdapter.
+type SlogOptions struct {
+	// Level is the minimum level reported as enabled to slog.
+	// All levels are enabled by default, leaving it to the toolkit
+	// handlers to filter records.
+	Level slog.Leveler
+}
+
+// SlogAdapter returns a slog.Handler which converts slog records into
+// Records and writes them to h, so that slog based code can log through
+// the handlers and formats of this package:
+//
+//	slog.SetDefault(slog.New(log.SlogAdapter(log.StdoutHandler, nil)))
+//
+// Attributes become typed fields. Groups are flattened into dotted keys
+// and LogValuers are resolved before the record is written.
+func SlogAdapter(h Handler, opts *SlogOptions) slog.Handler {
+	a := &slogAdapter{h: h}
+	if opts != nil {
+		a.level = opts.Level
+	}
+	return a
+}
+
+type slogAdapter struct {
+	h      Handler
+	level  slog.Leveler
+	prefix string
+	fields []Field
+}
+
+func (a *slogAdapter) Enabled(_ context.Context, level slog.Level) bool {
+	return a.level == nil || level >= a.level.Level()
+}
+
+func (a *slogAdapter) Handle(_ context.Context, sr slog.Record) error {
+	fields := make([]Field, len(a.fields), len(a.fields)+sr.NumAttrs())
+	copy(fields, a.fields)
+	sr.Attrs(func(attr slog.Attr) bool {
+		fields = appendSlogAttr(fields, a.prefix, attr)
+		return true
+	})
+
+	t := sr.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return a.h.Log(&Record{
+		Time:     t,
+		Level:    levelFromSlog(sr.Level),
+		Message:  sr.Message,
+		Context:  []interface{}{},
+		Fields:   fields,
+		Call:     callFromPC(sr.PC),
+		KeyNames: defaultKeyNames,
+	})
+}
+
+func (a *slogAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *a
+	child.fields = a.fields[:len(a.fields):len(a.fields)]
+	for _, attr := range attrs {
+		child.fields = appendSlogAttr(child.fields, a.prefix, attr)
+	}
+	return &child
+}
+
+func (a *slogAdapter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return a
+	}
+	child := *a
+	child.prefix = a.prefix + name + "."
+	return &child
+}
+
+// appendSlogAttr appends attr to fields as a typed Field, flattening groups
+// into keys joined with dots.
+func appendSlogAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	key := prefix + attr.Key
+	v := attr.Value
+	switch v.Kind() {
+	case slog.KindGroup:
+		if attr.Key != "" {
+			prefix = key + "."
+		}
+		for _, a := range v.Group() {
+			fields = appendSlogAttr(fields, prefix, a)
+		}
+		return fields
+	case slog.KindString:
+		return append(fields, String(key, v.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, Dur(key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, v.Time()))
+	default:
+		return append(fields, Any(key, v.Any()))
+	}
+}
+
+// callFromPC finds the frame of pc on the current goroutine's stack. The
+// zero Call is returned if pc is not on the stack, for example because the
+// record is handled asynchronously.
+func callFromPC(pc uintptr) stack.Call {
+	if pc == 0 {
+		return stack.Call{}
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+
+	// Look for pc among the raw program counters, which is cheap, and only
+	// resolve the frames from there on. The index of pc is a lower bound
+	// for its skip count, which also counts inlined calls.
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	for n == len(pcs) {
+		pcs = make([]uintptr, 2*len(pcs))
+		n = runtime.Callers(1, pcs)
+	}
+	for i, p := range pcs[:n] {
+		if p != pc {
+			continue
+		}
+		for skip := i; ; skip++ {
+			c := stack.Caller(skip)
+			f := c.Frame()
+			if f.PC == 0 {
+				return stack.Call{}
+			}
+			if f.PC == frame.PC && f.Function == frame.Function {
+				return c
+			}
+		}
+	}
+	return stack.Call{}
+}
+
+// SlogHandler returns a handler which writes log records to sh, so that
+// code logging through this package can share a slog.Handler with slog
+// based libraries. Context pairs and fields become attributes.
+func SlogHandler(sh slog.Handler) Handler {
+	return LazyHandler(&slogHandler{sh: sh})
+}
+
+type slogHandler struct {
+	sh slog.Handler
+}
+
+func (h *slogHandler) Log(r *Record) error {
+	ctx := context.Background()
+	level := slogLevel(r.Level)
+	if !h.sh.Enabled(ctx, level) {
+		return nil
+	}
+
+	var pc uintptr
+	if f := r.Call.Frame(); f.PC != 0 {
+		// slog expects a return address, as reported by runtime.Callers
+		pc = f.PC + 1
+	}
+
+	sr := slog.NewRecord(r.Time, level, r.Message, pc)
+	pairs := namedContext(r)
+	for i := 0; i < len(pairs); i += 2 {
+		k, ok := pairs[i].(string)
+		if !ok {
+			sr.AddAttrs(slog.Any(errorKey, pairs[i]))
+			continue
+		}
+		sr.AddAttrs(slog.Any(k, pairs[i+1]))
+	}
+	for _, f := range r.Fields {
+		sr.AddAttrs(slogAttr(f))
+	}
+	return h.sh.Handle(ctx, sr)
+}
+
+// slogAttr converts a typed Field into an slog.Attr of the same kind.
+func slogAttr(f Field) slog.Attr {
+	switch f.Type {
+	case StringType:
+		return slog.String(f.Key, f.String)
+	case Int64Type:
+		return slog.Int64(f.Key, f.Integer)
+	case Uint64Type:
+		return slog.Uint64(f.Key, uint64(f.Integer))
+	case BoolType:
+		return slog.Bool(f.Key, f.Integer == 1)
+	case DurationType:
+		return slog.Duration(f.Key, time.Duration(f.Integer))
+	case TimeType:
+		return slog.Time(f.Key, f.time())
+	default:
+		return slog.Any(f.Key, f.Value())
+	}
+}
+
+// slogLevel maps a LEVEL to the corresponding slog.Level. Trace and fatal,
+// which slog does not define, are placed four steps below debug and above
+// error respectively.
+func slogLevel(l LEVEL) slog.Level {
+	switch l {
+	case LevelTrace:
+		return slog.LevelDebug - 4
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarning:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
+}
+
+// levelFromSlog maps an slog.Level to the closest LEVEL at or below it.
+func levelFromSlog(l slog.Level) LEVEL {
+	switch {
+	case l < slog.LevelDebug:
+		return LevelTrace
+	case l < slog.LevelInfo:
+		return LevelDebug
+	case l < slog.LevelWarn:
+		return LevelInfo
+	case l < slog.LevelError:
+		return LevelWarning
+	case l < slog.LevelError+4:
+		return LevelError
+	default:
+		return LevelFatal
+	}
+}
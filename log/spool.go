@@ -0,0 +1,638 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSpoolMaxBytes    = 256 << 20
+	defaultSpoolSegmentSize = 8 << 20
+	defaultSpoolMinBackoff  = 100 * time.Millisecond
+	defaultSpoolMaxBackoff  = 30 * time.Second
+
+	spoolHeaderSize  = 8
+	spoolOffsetFile  = "offset"
+	spoolSegmentExt  = ".seg"
+	spoolOffsetEvery = time.Second
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SpoolOptions configures a SpoolHandler.
+type SpoolOptions struct {
+	// MaxBytes caps the disk space used by the spool. When it is reached
+	// the oldest segments are deleted, losing their records. Defaults to
+	// 256 MiB.
+	MaxBytes int64
+
+	// SegmentSize is the size after which a new segment file is started.
+	// Defaults to 8 MiB.
+	SegmentSize int64
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// attempts to write a record the downstream handler failed to write.
+	// Default to 100 milliseconds and 30 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// SpoolHandler returns a handler which appends log records to segment files
+// in dir and writes them to h from a background goroutine, in order. A
+// record is removed from the spool once h.Log returned nil for it; while h
+// fails, the record is retried with exponential backoff and new records
+// accumulate on disk. The spool therefore only helps with handlers which
+// report failed writes, such as SyslogNetHandler or a FuncHandler.
+//
+// The position of the next record to write is saved in dir, so records
+// which haven't been written when the process exits are written after it
+// is restarted with the same dir. Records are delivered at least once:
+// after a crash a few records may be written twice. Records lose their
+// call site and context values come back as the values they are encoded
+// to in JSON.
+//
+// Flushing the handler syncs the spool to disk. Closing it stops the
+// background goroutine, leaving unwritten records in the spool, and
+// closes h.
+func SpoolHandler(dir string, h Handler, opts SpoolOptions) (Handler, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultSpoolMaxBytes
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSpoolSegmentSize
+	}
+	if opts.SegmentSize > opts.MaxBytes {
+		opts.SegmentSize = opts.MaxBytes
+	}
+	backoffDefaults(&opts.MinBackoff, &opts.MaxBackoff, defaultSpoolMinBackoff, defaultSpoolMaxBackoff)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &spoolHandler{
+		dir:  dir,
+		h:    h,
+		opts: opts,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	return LazyHandler(s), nil
+}
+
+// spoolSegment is a segment file, named after its sequence number.
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	records int
+}
+
+type spoolHandler struct {
+	dir  string
+	h    Handler
+	opts SpoolOptions
+	quit chan struct{}
+	done chan struct{}
+
+	// mu guards the fields below; cond is signalled when records are
+	// appended or the handler is closed
+	mu       sync.Mutex
+	cond     *sync.Cond
+	segments []spoolSegment // oldest first, the last one is written to
+	file     *os.File       // the last segment
+	total    int64
+	readOff  int64 // position of the next record in segments[0]
+	dropped  int
+	closed   bool
+
+	// offsetMu serializes writes of the offset file
+	offsetMu sync.Mutex
+}
+
+func (s *spoolHandler) Log(r *Record) error {
+	entry := encodeSpoolEntry(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errHandlerClosed
+	}
+
+	// make room by dropping the oldest segments, never the one being
+	// written
+	for s.total+int64(len(entry)) > s.opts.MaxBytes && len(s.segments) > 1 {
+		s.dropOldest()
+	}
+	if s.total+int64(len(entry)) > s.opts.MaxBytes {
+		s.dropped++
+		return fmt.Errorf("log: spool %s is full", s.dir)
+	}
+
+	if s.segments[len(s.segments)-1].size >= s.opts.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	seg := &s.segments[len(s.segments)-1]
+	n, err := s.file.Write(entry)
+	seg.size += int64(n)
+	s.total += int64(n)
+	if err != nil {
+		// cut off the partial entry so the segment stays readable
+		seg.size -= int64(n)
+		s.total -= int64(n)
+		s.file.Truncate(seg.size)
+		s.file.Seek(seg.size, io.SeekStart)
+		return err
+	}
+	seg.records++
+	s.cond.Signal()
+	return nil
+}
+
+func (s *spoolHandler) Flush() error {
+	s.mu.Lock()
+	var err error
+	if !s.closed {
+		err = s.file.Sync()
+	}
+	seq, off := s.position()
+	s.mu.Unlock()
+
+	if werr := s.writeOffset(seq, off); err == nil {
+		err = werr
+	}
+	if ferr := flushHandler(s.h); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (s *spoolHandler) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.quit)
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	<-s.done
+
+	s.mu.Lock()
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	seq, off := s.position()
+	s.mu.Unlock()
+
+	if werr := s.writeOffset(seq, off); err == nil {
+		err = werr
+	}
+	if cerr := closeHandler(s.h); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// open loads the segments and the saved offset from disk and opens the
+// last segment for appending.
+func (s *spoolHandler) open() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolSegmentExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, spoolSegment{seq: seq})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	seq, off := s.readOffset()
+	for len(s.segments) > 0 && s.segments[0].seq < seq {
+		os.Remove(s.segmentPath(s.segments[0].seq))
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) > 0 && s.segments[0].seq == seq {
+		s.readOff = off
+	}
+
+	// validate the segments, cutting off records torn by a crash
+	for i := range s.segments {
+		seg := &s.segments[i]
+		size, records, err := scanSpoolSegment(s.segmentPath(seg.seq))
+		if err != nil {
+			return err
+		}
+		if i == 0 && s.readOff > size {
+			s.readOff = size
+		}
+		seg.size, seg.records = size, records
+		s.total += size
+	}
+
+	if len(s.segments) == 0 {
+		var next uint64 = 1
+		if seq > next {
+			next = seq
+		}
+		s.segments = append(s.segments, spoolSegment{seq: next})
+	}
+	last := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(s.segmentPath(last.seq), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(last.size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(last.size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+// scanSpoolSegment returns the size of the valid records at the start of
+// the segment file and their number.
+func scanSpoolSegment(path string) (int64, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var off int64
+	records := 0
+	for {
+		_, n := decodeSpoolFrame(data[off:])
+		if n == 0 {
+			return off, records, nil
+		}
+		off += int64(n)
+		records++
+	}
+}
+
+// rotate starts a new segment. It must be called with s.mu held.
+func (s *spoolHandler) rotate() error {
+	seq := s.segments[len(s.segments)-1].seq + 1
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.file.Sync()
+	s.file.Close()
+	s.file = f
+	s.segments = append(s.segments, spoolSegment{seq: seq})
+	return nil
+}
+
+// dropOldest deletes the oldest segment. It must be called with s.mu held
+// and more than one segment.
+func (s *spoolHandler) dropOldest() {
+	seg := s.segments[0]
+	os.Remove(s.segmentPath(seg.seq))
+	s.segments = s.segments[1:]
+	s.total -= seg.size
+	s.dropped += seg.records
+	s.readOff = 0
+}
+
+// position returns the position of the next record to write downstream.
+// It must be called with s.mu held.
+func (s *spoolHandler) position() (uint64, int64) {
+	return s.segments[0].seq, s.readOff
+}
+
+func (s *spoolHandler) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+func (s *spoolHandler) readOffset() (uint64, int64) {
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolOffsetFile))
+	if err != nil {
+		return 0, 0
+	}
+	var seq uint64
+	var off int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &off); err != nil {
+		return 0, 0
+	}
+	return seq, off
+}
+
+// writeOffset saves the position of the next record, replacing the offset
+// file atomically so that a crash leaves either the old or the new one.
+func (s *spoolHandler) writeOffset(seq uint64, off int64) error {
+	s.offsetMu.Lock()
+	defer s.offsetMu.Unlock()
+
+	path := filepath.Join(s.dir, spoolOffsetFile)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(f, "%d %d\n", seq, off); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if d, err := os.Open(s.dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// run writes the spooled records to the downstream handler.
+func (s *spoolHandler) run() {
+	defer close(s.done)
+
+	lastSave := time.Now()
+	saved := true
+	for {
+		s.mu.Lock()
+		entry, seq, next, ok := s.next()
+		for !ok && !s.closed {
+			if !saved {
+				// idle, a good time to save the position
+				seq, off := s.position()
+				s.mu.Unlock()
+				s.writeOffset(seq, off)
+				saved = true
+				s.mu.Lock()
+			} else {
+				s.cond.Wait()
+			}
+			entry, seq, next, ok = s.next()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		dropped := s.dropped
+		s.dropped = 0
+		s.mu.Unlock()
+
+		if dropped > 0 && !s.deliver(droppedRecord(int64(dropped))) {
+			return
+		}
+		if r, err := decodeSpoolRecord(entry); err == nil {
+			if !s.deliver(r) {
+				return
+			}
+		}
+
+		s.mu.Lock()
+		if s.segments[0].seq == seq {
+			s.readOff = next
+		}
+		saved = false
+		if time.Since(lastSave) >= spoolOffsetEvery {
+			seq, off := s.position()
+			s.mu.Unlock()
+			s.writeOffset(seq, off)
+			lastSave, saved = time.Now(), true
+		} else {
+			s.mu.Unlock()
+		}
+	}
+}
+
+// next returns the next record to write downstream, the segment holding
+// it and the position after it, deleting segments which have been written
+// completely. It must be called with s.mu held.
+func (s *spoolHandler) next() ([]byte, uint64, int64, bool) {
+	for {
+		seg := s.segments[0]
+		if s.readOff < seg.size {
+			entry, n, err := s.readEntry(seg, s.readOff)
+			if err == nil {
+				return entry, seg.seq, s.readOff + int64(n), true
+			}
+			// unreadable, skip the rest of the segment
+			s.readOff = seg.size
+		}
+		if len(s.segments) == 1 {
+			return nil, 0, 0, false
+		}
+		os.Remove(s.segmentPath(seg.seq))
+		s.segments = s.segments[1:]
+		s.total -= seg.size
+		s.readOff = 0
+	}
+}
+
+func (s *spoolHandler) readEntry(seg spoolSegment, off int64) ([]byte, int, error) {
+	f, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var hdr [spoolHeaderSize]byte
+	if _, err := f.ReadAt(hdr[:], off); err != nil {
+		return nil, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(hdr[:4]))
+	if off+spoolHeaderSize+size > seg.size {
+		return nil, 0, errors.New("log: spool entry exceeds its segment")
+	}
+	frame := make([]byte, spoolHeaderSize+size)
+	if _, err := f.ReadAt(frame, off); err != nil {
+		return nil, 0, err
+	}
+	entry, n := decodeSpoolFrame(frame)
+	if n == 0 {
+		return nil, 0, errors.New("log: corrupt spool entry")
+	}
+	return entry, n, nil
+}
+
+// deliver writes r downstream, retrying with backoff until it succeeds. It
+// returns false if the handler was closed in the meantime.
+func (s *spoolHandler) deliver(r *Record) bool {
+	backoff := s.opts.MinBackoff
+	for {
+		if s.h.Log(r) == nil {
+			return true
+		}
+		select {
+		case <-time.After(backoffDelay(backoff)):
+		case <-s.quit:
+			return false
+		}
+		backoff = nextBackoff(backoff, s.opts.MaxBackoff)
+	}
+}
+
+// encodeSpoolEntry encodes r as a frame of its length, the CRC-32C of the
+// payload and the payload, a JSON object.
+func encodeSpoolEntry(r *Record) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, spoolHeaderSize))
+
+	buf.WriteString(`{"t":`)
+	buf.WriteString(strconv.FormatInt(r.Time.UnixNano(), 10))
+	buf.WriteString(`,"l":`)
+	buf.WriteString(strconv.Itoa(int(r.Level)))
+	buf.WriteString(`,"m":`)
+	appendJSONString(buf, r.Message)
+	if r.Name != "" {
+		buf.WriteString(`,"n":`)
+		appendJSONString(buf, r.Name)
+	}
+	if len(r.Context) > 0 {
+		buf.WriteString(`,"c":[`)
+		for i, v := range r.Context {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			appendJSONValue(buf, v)
+		}
+		buf.WriteByte(']')
+	}
+	if len(r.Fields) > 0 {
+		buf.WriteString(`,"f":[`)
+		for i, f := range r.Fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(`{"k":`)
+			appendJSONString(buf, f.Key)
+			buf.WriteString(`,"t":`)
+			buf.WriteString(strconv.Itoa(int(f.Type)))
+			switch f.Type {
+			case StringType:
+				buf.WriteString(`,"s":`)
+				appendJSONString(buf, f.String)
+			case TimeType:
+				buf.WriteString(`,"i":`)
+				buf.WriteString(strconv.FormatInt(f.Integer, 10))
+				buf.WriteString(`,"s":`)
+				appendJSONString(buf, f.time().Location().String())
+			case ErrorType, AnyType:
+				buf.WriteString(`,"v":`)
+				appendJSONField(buf, f)
+			default:
+				buf.WriteString(`,"i":`)
+				buf.WriteString(strconv.FormatInt(f.Integer, 10))
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+
+	b := buf.Bytes()
+	payload := b[spoolHeaderSize:]
+	binary.BigEndian.PutUint32(b[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.Checksum(payload, crcTable))
+	return b
+}
+
+// decodeSpoolFrame returns the payload of the frame at the start of data
+// and the size of the frame, or 0 if data doesn't start with a complete,
+// intact frame.
+func decodeSpoolFrame(data []byte) ([]byte, int) {
+	if len(data) < spoolHeaderSize {
+		return nil, 0
+	}
+	size := int(binary.BigEndian.Uint32(data[:4]))
+	if size > len(data)-spoolHeaderSize {
+		return nil, 0
+	}
+	payload := data[spoolHeaderSize : spoolHeaderSize+size]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(data[4:8]) {
+		return nil, 0
+	}
+	return payload, spoolHeaderSize + size
+}
+
+type spoolRecord struct {
+	Time    int64         `json:"t"`
+	Level   LEVEL         `json:"l"`
+	Message string        `json:"m"`
+	Name    string        `json:"n"`
+	Context []interface{} `json:"c"`
+	Fields  []struct {
+		Key     string      `json:"k"`
+		Type    FieldType   `json:"t"`
+		Integer int64       `json:"i"`
+		String  string      `json:"s"`
+		Value   interface{} `json:"v"`
+	} `json:"f"`
+}
+
+func decodeSpoolRecord(payload []byte) (*Record, error) {
+	var sr spoolRecord
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&sr); err != nil {
+		return nil, err
+	}
+
+	r := &Record{
+		Time:     time.Unix(0, sr.Time),
+		Level:    sr.Level,
+		Message:  sr.Message,
+		Context:  sr.Context,
+		KeyNames: defaultKeyNames,
+		Name:     sr.Name,
+	}
+	if r.Context == nil {
+		r.Context = []interface{}{}
+	}
+	for _, f := range sr.Fields {
+		field := Field{Key: f.Key, Type: f.Type, Integer: f.Integer, String: f.String}
+		switch f.Type {
+		case TimeType:
+			field.String = ""
+			if loc, err := time.LoadLocation(f.String); err == nil {
+				field.Interface = loc
+			}
+		case ErrorType:
+			if msg, ok := f.Value.(string); ok {
+				field.Interface = errors.New(msg)
+			}
+		case AnyType:
+			field.Interface = f.Value
+		}
+		r.Fields = append(r.Fields, field)
+	}
+	return r, nil
+}
@@ -0,0 +1,262 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gateHandler records the records written to it while it lets them
+// through, and fails once allow records have been written.
+type gateHandler struct {
+	recorder
+	allow int64
+}
+
+func newGateHandler(allow int64) *gateHandler {
+	return &gateHandler{allow: allow}
+}
+
+func (g *gateHandler) Log(r *Record) error {
+	if atomic.AddInt64(&g.allow, -1) < 0 {
+		atomic.AddInt64(&g.allow, 1)
+		return errors.New("downstream is down")
+	}
+	return g.recorder.Log(r)
+}
+
+// messages waits until n records have been written and returns their
+// messages.
+func (g *gateHandler) messages(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.mu.Lock()
+		var msgs []string
+		for _, r := range g.records {
+			msgs = append(msgs, r.Message)
+		}
+		g.mu.Unlock()
+		if len(msgs) >= n {
+			return msgs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d records %q, want %d", len(msgs), msgs, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// quiet checks that no more than n records are written within a while.
+func (g *gateHandler) quiet(t *testing.T, n int) {
+	t.Helper()
+	time.Sleep(50 * time.Millisecond)
+	if msgs := g.messages(t, 0); len(msgs) > n {
+		t.Fatalf("got %d records %q, want %d", len(msgs), msgs, n)
+	}
+}
+
+func openSpool(t *testing.T, dir string, h Handler, opts SpoolOptions) Handler {
+	t.Helper()
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+	}
+	s, err := SpoolHandler(dir, h, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func spoolMessages(t *testing.T, s Handler, msgs ...string) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := s.Log(testRecord(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	return fmt.Sprintf("%q", a) == fmt.Sprintf("%q", b)
+}
+
+func TestSpoolHandlerRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// nothing gets through before the handler is closed
+	s := openSpool(t, dir, newGateHandler(0), SpoolOptions{MinBackoff: time.Hour})
+	r := testRecord("first", "user", "jane")
+	r.Fields = []Field{Int("status", 200)}
+	r.Name = "db"
+	if err := s.Log(r); err != nil {
+		t.Fatal(err)
+	}
+	spoolMessages(t, s, "second", "third")
+	if err := closeHandler(s); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newGateHandler(math.MaxInt64 / 2)
+	s = openSpool(t, dir, g, SpoolOptions{})
+	if msgs := g.messages(t, 3); !equalStrings(msgs, []string{"first", "second", "third"}) {
+		t.Fatalf("got %q after restart", msgs)
+	}
+	first := g.records[0]
+	if !first.Time.Equal(r.Time) || first.Level != r.Level || first.Name != "db" {
+		t.Errorf("got record %+v, want %+v", first, r)
+	}
+	if got := fmt.Sprint(recordValues(first)); got != "map[status:[200] user:[jane]]" {
+		t.Errorf("got values %s", got)
+	}
+	spoolMessages(t, s, "fourth")
+	g.messages(t, 4)
+	if err := closeHandler(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// the records written before the clean Close aren't written again
+	g = newGateHandler(math.MaxInt64 / 2)
+	s = openSpool(t, dir, g, SpoolOptions{})
+	defer closeHandler(s)
+	g.quiet(t, 0)
+	spoolMessages(t, s, "fifth")
+	if msgs := g.messages(t, 1); !equalStrings(msgs, []string{"fifth"}) {
+		t.Errorf("got %q after the second restart", msgs)
+	}
+}
+
+func TestSpoolHandlerTornFrame(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		tail func(frame []byte) []byte
+	}{
+		{"Truncated", func(frame []byte) []byte { return frame[:len(frame)/2] }},
+		{"Header", func(frame []byte) []byte { return frame[:spoolHeaderSize-1] }},
+		{"Corrupt", func(frame []byte) []byte {
+			frame[len(frame)-2] ^= 0xff
+			return frame
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openSpool(t, dir, newGateHandler(0), SpoolOptions{MinBackoff: time.Hour})
+			spoolMessages(t, s, "first", "second")
+			closeHandler(s)
+
+			// a crash in the middle of writing the third record
+			names := segmentFiles(t, dir)
+			if len(names) != 1 {
+				t.Fatalf("got segments %q", names)
+			}
+			fi, err := os.Stat(names[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(names[0], os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(test.tail(encodeSpoolEntry(testRecord("torn"))))
+			f.Close()
+
+			g := newGateHandler(math.MaxInt64 / 2)
+			s = openSpool(t, dir, g, SpoolOptions{})
+			defer closeHandler(s)
+
+			// the torn record is cut off, so the next one follows the
+			// intact ones
+			if fi2, err := os.Stat(names[0]); err != nil || fi2.Size() != fi.Size() {
+				t.Errorf("segment has %d bytes after reopening, want %d", fi2.Size(), fi.Size())
+			}
+			spoolMessages(t, s, "third")
+			if msgs := g.messages(t, 3); !equalStrings(msgs, []string{"first", "second", "third"}) {
+				t.Errorf("got %q", msgs)
+			}
+			g.quiet(t, 3)
+		})
+	}
+}
+
+func TestSpoolHandlerMaxBytes(t *testing.T) {
+	// every message has the same length, so every segment holds two
+	// records and the spool four
+	size := int64(len(encodeSpoolEntry(testRecord("r1"))))
+	entered, release := make(chan struct{}), make(chan struct{})
+	g := newGateHandler(math.MaxInt64 / 2)
+	dir := t.TempDir()
+	s := openSpool(t, dir, FuncHandler(func(r *Record) error {
+		if r.Message == "r1" {
+			close(entered)
+			<-release
+		}
+		return g.Log(r)
+	}), SpoolOptions{
+		SegmentSize: 2 * size,
+		MaxBytes:    4 * size,
+	})
+	defer closeHandler(s)
+
+	// r1 is being written while the first two segments are dropped
+	spoolMessages(t, s, "r1")
+	<-entered
+	spoolMessages(t, s, "r2", "r3", "r4", "r5", "r6", "r7", "r8")
+	if names := segmentFiles(t, dir); len(names) != 2 {
+		t.Errorf("got segments %q, want the third and the fourth", names)
+	}
+	close(release)
+
+	want := []string{"r1", "dropped log records", "r5", "r6", "r7", "r8"}
+	if msgs := g.messages(t, len(want)); !equalStrings(msgs, want) {
+		t.Fatalf("got %q, want %q", msgs, want)
+	}
+	if dropped := recordValues(g.records[1])["dropped"]; fmt.Sprint(dropped) != "[4]" {
+		t.Errorf("got dropped=%v, want 4", dropped)
+	}
+}
+
+func TestSpoolHandlerSegments(t *testing.T) {
+	dir := t.TempDir()
+	size := int64(len(encodeSpoolEntry(testRecord("r1"))))
+	opts := SpoolOptions{SegmentSize: 2 * size}
+
+	// three of the five records get through, the fourth is the first one
+	// in the second segment which isn't written
+	g := newGateHandler(3)
+	s := openSpool(t, dir, g, opts)
+	spoolMessages(t, s, "r1", "r2", "r3", "r4", "r5")
+	g.messages(t, 3)
+	if err := closeHandler(s); err != nil {
+		t.Fatal(err)
+	}
+	if names := segmentFiles(t, dir); len(names) != 2 {
+		t.Errorf("got segments %q, want the second and the third", names)
+	}
+
+	g = newGateHandler(math.MaxInt64 / 2)
+	s = openSpool(t, dir, g, opts)
+	defer closeHandler(s)
+	if msgs := g.messages(t, 2); !equalStrings(msgs, []string{"r4", "r5"}) {
+		t.Fatalf("got %q after restart", msgs)
+	}
+	g.quiet(t, 2)
+
+	// segments are deleted once they have been written
+	if names := segmentFiles(t, dir); len(names) != 1 || filepath.Base(names[0]) != fmt.Sprintf("%020d%s", 3, spoolSegmentExt) {
+		t.Errorf("got segments %q, want only the third", names)
+	}
+}
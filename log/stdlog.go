@@ -0,0 +1,213 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	stdlog "log"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/go-stack/stack"
+)
+
+// pkgPrefix is the prefix of the function names in this package.
+var pkgPrefix = reflect.TypeOf(logger{}).PkgPath() + "."
+
+// StdLogger returns a standard library logger which writes every line it
+// is given as a record of l at the given level. A leading level in the
+// line, such as "[WARN] ..." or "error: ...", overrides level. This is
+// useful for libraries which only accept a *log.Logger.
+func StdLogger(l Logger, level LEVEL) *stdlog.Logger {
+	return stdlog.New(WriterEx(l, level, true), "", 0)
+}
+
+// Writer returns an io.Writer which writes every line written to it as a
+// record of the root logger at the given level.
+func Writer(level LEVEL) io.Writer {
+	return WriterEx(root, level, false)
+}
+
+// WriterEx returns an io.Writer which writes every line written to it as a
+// record of l at the given level. Incomplete lines are buffered until the
+// rest of the line is written, or until the writer's Flush method or
+// Shutdown is called. If parseLevel is true, a leading level such
+// as "[WARN] ..." or "error: ..." is removed from the line and overrides
+// level.
+//
+// The records are attributed to the first caller outside of this package
+// and the standard library log and fmt packages.
+func WriterEx(l Logger, level LEVEL, parseLevel bool) io.Writer {
+	return &logWriter{l: l, level: level, parseLevel: parseLevel}
+}
+
+// RedirectStdLog makes the standard library's global logger write to the
+// root logger at the given level, honouring level prefixes in the
+// messages. It returns a function which restores the previous output,
+// flags and prefix.
+func RedirectStdLog(level LEVEL) (restore func()) {
+	w, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	stdlog.SetOutput(WriterEx(root, level, true))
+	stdlog.SetFlags(0)
+	stdlog.SetPrefix("")
+
+	return func() {
+		stdlog.SetOutput(w)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+	}
+}
+
+type logWriter struct {
+	mu         sync.Mutex
+	l          Logger
+	level      LEVEL
+	parseLevel bool
+	buf        []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimSuffix(w.buf[:i], []byte{'\r'}))
+		w.buf = w.buf[i+1:]
+		if line != "" {
+			w.emit(line)
+		}
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+		pendingWriters.remove(w)
+	} else {
+		pendingWriters.add(w)
+	}
+	return len(p), nil
+}
+
+// Flush writes an incomplete line as a record of its own.
+func (w *logWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := string(bytes.TrimSuffix(w.buf, []byte{'\r'}))
+	w.buf = nil
+	pendingWriters.remove(w)
+	if line != "" {
+		w.emit(line)
+	}
+	return nil
+}
+
+func (w *logWriter) emit(line string) {
+	level := w.level
+	if w.parseLevel {
+		if lvl, rest, ok := parseLevelPrefix(line); ok {
+			level, line = lvl, rest
+		}
+	}
+
+	if l, ok := w.l.(*logger); ok {
+		l.writeCall(externalCaller(), level, line, nil, nil)
+	} else {
+		w.l.Log(level, line)
+	}
+}
+
+// pendingWriters are the writers holding an incomplete line, which
+// Shutdown writes before it flushes the handlers.
+var pendingWriters = &writerSet{m: make(map[*logWriter]struct{})}
+
+type writerSet struct {
+	mu sync.Mutex
+	m  map[*logWriter]struct{}
+}
+
+func (s *writerSet) add(w *logWriter) {
+	s.mu.Lock()
+	s.m[w] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *writerSet) remove(w *logWriter) {
+	s.mu.Lock()
+	delete(s.m, w)
+	s.mu.Unlock()
+}
+
+// flush flushes every writer in the set.
+func (s *writerSet) flush() {
+	s.mu.Lock()
+	ws := make([]*logWriter, 0, len(s.m))
+	for w := range s.m {
+		ws = append(ws, w)
+	}
+	s.mu.Unlock()
+
+	for _, w := range ws {
+		w.Flush()
+	}
+}
+
+// externalCaller returns the innermost call outside of this package and
+// the standard library log and fmt packages.
+func externalCaller() stack.Call {
+	// Only resolve the frames up to the one we're looking for, whose
+	// position among the logical frames, which include inlined calls, is
+	// its skip count.
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	for n == len(pcs) {
+		pcs = make([]uintptr, 2*len(pcs))
+		n = runtime.Callers(1, pcs)
+	}
+	frames := runtime.CallersFrames(pcs[:n])
+	for skip := 0; ; skip++ {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, pkgPrefix) && !strings.HasPrefix(f.Function, "log.") && !strings.HasPrefix(f.Function, "fmt.") {
+			if c := stack.Caller(skip); c.Frame().PC == f.PC {
+				return c
+			}
+			return stack.Call{}
+		}
+		if !more {
+			return stack.Call{}
+		}
+	}
+}
+
+// parseLevelPrefix recognizes lines starting with "[LEVEL]" or "LEVEL:"
+// and returns the level and the rest of the line.
+func parseLevelPrefix(line string) (LEVEL, string, bool) {
+	var name, rest string
+	if strings.HasPrefix(line, "[") {
+		i := strings.IndexByte(line, ']')
+		if i < 0 {
+			return 0, line, false
+		}
+		name, rest = line[1:i], line[i+1:]
+	} else {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return 0, line, false
+		}
+		name, rest = line[:i], line[i+1:]
+	}
+
+	// level names are short, don't parse long words or sentences
+	if len(name) > len("warning") {
+		return 0, line, false
+	}
+	lvl, err := LevelFromString(name)
+	if err != nil {
+		return 0, line, false
+	}
+	return lvl, strings.TrimLeft(rest, " "), true
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-stack/stack"
+)
+
+func TestWriterPartialLine(t *testing.T) {
+	h := useRecorder(t)
+	w := WriterEx(root, LevelInfo, true)
+
+	fmt.Fprint(w, "first\nsec")
+	fmt.Fprint(w, "ond")
+	if len(h.records) != 1 || h.records[0].Message != "first" {
+		t.Fatalf("got %d records before the line was complete", len(h.records))
+	}
+	if err := w.(interface{ Flush() error }).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.records) != 2 || h.records[1].Message != "second" {
+		t.Fatalf("got %d records after Flush", len(h.records))
+	}
+
+	// Shutdown writes what is left
+	fmt.Fprint(w, "[WARN] last\r")
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.records) != 3 || h.records[2].Message != "last" || h.records[2].Level != LevelWarning {
+		t.Fatalf("got %d records after Shutdown", len(h.records))
+	}
+}
+
+func TestStdLoggerCaller(t *testing.T) {
+	h := useRecorder(t)
+	l := StdLogger(root, LevelInfo)
+
+	// the test itself is in this package, so its caller is the first one
+	// outside of it
+	l.Printf("error: %d", 42)
+	fmt.Fprintln(l.Writer(), "direct")
+	if len(h.records) != 2 || h.records[0].Level != LevelError || h.records[0].Message != "42" {
+		t.Fatalf("got %d records", len(h.records))
+	}
+	for _, r := range h.records {
+		if fn := r.Call.Frame().Function; fn != "testing.tRunner" {
+			t.Errorf("%q is attributed to %s", r.Message, fn)
+		}
+	}
+
+	var want stack.Call
+	for _, c := range stack.Trace() {
+		if !strings.HasPrefix(c.Frame().Function, pkgPrefix) {
+			want = c
+			break
+		}
+	}
+	if got := externalCaller(); got.Frame() != want.Frame() {
+		t.Errorf("got caller %+v, want %+v", got.Frame(), want.Frame())
+	}
+}
@@ -0,0 +1,359 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is a syslog facility as defined by RFC 5424.
+type Facility int
+
+// List of syslog facilities. The kernel facility (0) is reserved for the
+// kernel and not available; the zero value of Facility means FacilityUser.
+const (
+	FacilityUser Facility = iota + 1
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+)
+
+// List of local use syslog facilities
+const (
+	FacilityLocal0 Facility = iota + 16
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// SyslogProtocol selects the syslog message format.
+type SyslogProtocol int
+
+// List of supported syslog message formats
+const (
+	SyslogRFC5424 SyslogProtocol = iota
+	SyslogRFC3164
+)
+
+// SyslogFraming selects how messages are delimited on stream transports
+// such as TCP. Datagram transports always send one message per packet.
+type SyslogFraming int
+
+// List of syslog framing methods, see RFC 6587
+const (
+	// FramingOctetCounting prefixes each message with its length.
+	FramingOctetCounting SyslogFraming = iota
+	// FramingNonTransparent terminates each message with a newline.
+	// Newlines within the message are escaped as "\n".
+	FramingNonTransparent
+)
+
+const (
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	syslogSDID       = "toolkit@32473"
+)
+
+// SyslogOptions configures a syslog handler.
+type SyslogOptions struct {
+	// Protocol is the message format, RFC 5424 by default.
+	Protocol SyslogProtocol
+
+	// Facility is the facility of every message, FacilityUser by default.
+	Facility Facility
+
+	// AppName identifies the program, the base name of os.Args[0] by default.
+	AppName string
+
+	// Hostname is the host name sent in every message, os.Hostname by default.
+	Hostname string
+
+	// StructuredDataID is the SD-ID under which the record context is sent
+	// as RFC 5424 structured data. Defaults to "toolkit@32473".
+	StructuredDataID string
+
+	// Framing is used on stream transports, octet counting by default.
+	Framing SyslogFraming
+
+	// Format, if set, formats the message body and no structured data is
+	// sent. By default the body is the record message, followed by the
+	// context in logfmt style for RFC 3164.
+	Format Format
+}
+
+// SyslogHandler opens a connection to the local syslog daemon and returns a
+// handler which writes log records to it. The connection is reopened when
+// writing to it fails.
+func SyslogHandler(opts SyslogOptions) (Handler, error) {
+	return newSyslogHandler("", "", opts)
+}
+
+// SyslogNetHandler opens a connection to a syslog daemon listening at addr
+// on the given network ("udp", "tcp", "unix", "unixgram", ...) and returns
+// a handler which writes log records to it. The connection is reopened
+// when writing to it fails.
+func SyslogNetHandler(network, addr string, opts SyslogOptions) (Handler, error) {
+	return newSyslogHandler(network, addr, opts)
+}
+
+func newSyslogHandler(network, addr string, opts SyslogOptions) (Handler, error) {
+	if opts.Facility == 0 {
+		opts.Facility = FacilityUser
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.StructuredDataID == "" {
+		opts.StructuredDataID = syslogSDID
+	}
+
+	h := &syslogHandler{
+		network: network,
+		addr:    addr,
+		opts:    opts,
+		pid:     strconv.Itoa(os.Getpid()),
+	}
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	return LazyHandler(h), nil
+}
+
+type syslogHandler struct {
+	mu      sync.Mutex
+	network string
+	addr    string
+	opts    SyslogOptions
+	pid     string
+	conn    net.Conn
+	stream  bool
+	closed  bool
+}
+
+func (h *syslogHandler) Log(r *Record) error {
+	msg := h.message(r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return errHandlerClosed
+	}
+	if h.conn != nil {
+		if err := h.write(msg); err == nil {
+			return nil
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	if err := h.connect(); err != nil {
+		return err
+	}
+	return h.write(msg)
+}
+
+func (h *syslogHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+// connect dials the configured address, or the local syslog socket if
+// there is none. It must be called with h.mu held or before the handler
+// is in use.
+func (h *syslogHandler) connect() error {
+	if h.network != "" {
+		conn, err := net.Dial(h.network, h.addr)
+		if err != nil {
+			return err
+		}
+		h.conn = conn
+		h.stream = isStreamNetwork(h.network)
+		return nil
+	}
+
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				h.conn = conn
+				h.stream = network == "unix"
+				return nil
+			}
+		}
+	}
+	return errors.New("log: unix syslog delivery error")
+}
+
+func (h *syslogHandler) write(msg []byte) error {
+	if h.stream {
+		if h.opts.Framing == FramingNonTransparent {
+			// a newline would end the message early, so it is escaped
+			msg = append(bytes.ReplaceAll(msg, []byte{'\n'}, []byte(`\n`)), '\n')
+		} else {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+	}
+	_, err := h.conn.Write(msg)
+	return err
+}
+
+func isStreamNetwork(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
+// message formats r as a syslog message without framing.
+func (h *syslogHandler) message(r *Record) []byte {
+	pri := int(h.opts.Facility)*8 + syslogSeverity(r.Level)
+	b := &bytes.Buffer{}
+
+	if h.opts.Protocol == SyslogRFC3164 {
+		fmt.Fprintf(b, "<%d>%s ", pri, r.Time.Format(time.Stamp))
+		if h.network != "" {
+			b.WriteString(syslogField(h.opts.Hostname, "localhost"))
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(b, "%s[%s]: ", h.opts.AppName, h.pid)
+		if h.opts.Format != nil {
+			b.Write(bytes.TrimRight(h.opts.Format.Format(r), "\n"))
+		} else {
+			b.WriteString(r.Message)
+			if len(r.Context)+len(r.Fields) > 0 {
+				b.WriteByte(' ')
+				logfmt(b, r.Context, r.Fields, 0)
+				b.Truncate(b.Len() - 1)
+			}
+		}
+		return b.Bytes()
+	}
+
+	fmt.Fprintf(b, "<%d>1 %s %s %s %s - ", pri, r.Time.Format(syslogTimeFormat),
+		syslogField(h.opts.Hostname, "-"), syslogField(h.opts.AppName, "-"), h.pid)
+	if h.opts.Format != nil {
+		b.WriteString("- ")
+		b.Write(bytes.TrimRight(h.opts.Format.Format(r), "\n"))
+		return b.Bytes()
+	}
+
+	h.structuredData(b, recordContext(r))
+	if r.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(r.Message)
+	}
+	return b.Bytes()
+}
+
+// structuredData writes ctx as a single RFC 5424 SD-ELEMENT, or the nil
+// value if there is no context.
+func (h *syslogHandler) structuredData(b *bytes.Buffer, ctx []interface{}) {
+	if len(ctx) == 0 {
+		b.WriteByte('-')
+		return
+	}
+
+	b.WriteByte('[')
+	b.WriteString(h.opts.StructuredDataID)
+	for i := 0; i < len(ctx); i += 2 {
+		k, ok := ctx[i].(string)
+		v := ctx[i+1]
+		if !ok {
+			k, v = errorKey, fmt.Sprintf("%+v is not a string key", ctx[i])
+		}
+		b.WriteByte(' ')
+		b.WriteString(sdName(k))
+		b.WriteString(`="`)
+		b.WriteString(sdValue(fmt.Sprintf("%+v", formatShared(v))))
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+}
+
+// syslogSeverity maps a LEVEL to a syslog severity.
+func syslogSeverity(l LEVEL) int {
+	switch l {
+	case LevelFatal:
+		return 2
+	case LevelError:
+		return 3
+	case LevelWarning:
+		return 4
+	case LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// syslogField replaces spaces in a header field, or returns nilValue for
+// an empty one.
+func syslogField(s, nilValue string) string {
+	if s == "" {
+		return nilValue
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+// sdName turns a context key into a valid SD-NAME: at most 32 printable
+// ASCII characters except '=', ' ', ']' and '"'.
+func sdName(k string) string {
+	name := []byte(k)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	for i, c := range name {
+		if c <= ' ' || c >= 127 || c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
+
+// sdValue escapes the characters RFC 5424 requires in a PARAM-VALUE.
+func sdValue(v string) string {
+	if !strings.ContainsAny(v, "\"\\]") {
+		return v
+	}
+	var b strings.Builder
+	for _, r := range v {
+		if r == '"' || r == '\\' || r == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,220 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tcpListener listens on a local TCP port and sends the connections it
+// accepts on a channel. They are closed at the end of the test.
+func tcpListener(t *testing.T) (net.Listener, <-chan net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var accepted []net.Conn
+	conns := make(chan net.Conn, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			accepted = append(accepted, conn)
+			mu.Unlock()
+			conns <- conn
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range accepted {
+			conn.Close()
+		}
+	})
+	return ln, conns
+}
+
+// accept waits for the next connection on conns.
+func accept(t *testing.T, conns <-chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-conns:
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection")
+		return nil
+	}
+}
+
+// testRecord returns a record with a fixed time.
+func testRecord(msg string, ctx ...interface{}) *Record {
+	return &Record{
+		Time:     benchTime,
+		Level:    LevelInfo,
+		Message:  msg,
+		Context:  ctx,
+		KeyNames: defaultKeyNames,
+	}
+}
+
+func TestSyslogNetHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	pid := os.Getpid()
+	for _, test := range []struct {
+		protocol SyslogProtocol
+		want     string
+	}{
+		{SyslogRFC5424, fmt.Sprintf(`<14>1 2024-01-02T03:04:05.000000Z my_host app %d - [toolkit@32473 k="v\]" n="1"] hello`, pid)},
+		{SyslogRFC3164, fmt.Sprintf(`<14>Jan  2 03:04:05 my_host app[%d]: hello k=v] n=1`, pid)},
+	} {
+		h, err := SyslogNetHandler("udp", pc.LocalAddr().String(), SyslogOptions{
+			Protocol: test.protocol,
+			Hostname: "my host",
+			AppName:  "app",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Log(testRecord("hello", "k", "v]", "n", 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 1024)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != test.want {
+			t.Errorf("got  %q\nwant %q", got, test.want)
+		}
+		closeHandler(h)
+	}
+}
+
+func TestSyslogNetHandlerFraming(t *testing.T) {
+	ln, conns := tcpListener(t)
+	opts := SyslogOptions{Hostname: "host", AppName: "app"}
+
+	t.Run("OctetCounting", func(t *testing.T) {
+		h, err := SyslogNetHandler("tcp", ln.Addr().String(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeHandler(h)
+		r := bufio.NewReader(accept(t, conns))
+
+		for _, msg := range []string{"first", "second\nline"} {
+			if err := h.Log(testRecord(msg)); err != nil {
+				t.Fatal(err)
+			}
+			size, err := r.ReadString(' ')
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+			if err != nil {
+				t.Fatalf("bad length %q", size)
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(string(b), " - "+msg) {
+				t.Errorf("got %q, want message %q", b, msg)
+			}
+		}
+	})
+
+	t.Run("NonTransparent", func(t *testing.T) {
+		opts := opts
+		opts.Framing = FramingNonTransparent
+		h, err := SyslogNetHandler("tcp", ln.Addr().String(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeHandler(h)
+		r := bufio.NewReader(accept(t, conns))
+
+		for _, msg := range []string{"first", "second\nline\n"} {
+			if err := h.Log(testRecord(msg)); err != nil {
+				t.Fatal(err)
+			}
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := " - " + strings.ReplaceAll(msg, "\n", `\n`) + "\n"
+			if !strings.HasSuffix(line, want) {
+				t.Errorf("got %q, want suffix %q", line, want)
+			}
+		}
+	})
+}
+
+func TestSyslogNetHandlerReconnect(t *testing.T) {
+	ln, conns := tcpListener(t)
+	h, err := SyslogNetHandler("tcp", ln.Addr().String(), SyslogOptions{
+		Framing: FramingNonTransparent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := accept(t, conns)
+	h.Log(testRecord("before"))
+	if line, err := bufio.NewReader(first).ReadString('\n'); err != nil || !strings.HasSuffix(line, " before\n") {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	first.Close()
+
+	// the first writes after the server closed the connection may still
+	// succeed, so log until the handler notices and reconnects
+	var second net.Conn
+	for i := 0; second == nil; i++ {
+		if i == 100 {
+			t.Fatal("handler did not reconnect")
+		}
+		h.Log(testRecord("after"))
+		select {
+		case second = <-conns:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if line, err := bufio.NewReader(second).ReadString('\n'); err != nil || !strings.HasSuffix(line, " after\n") {
+		t.Fatalf("got %q, %v", line, err)
+	}
+
+	if err := closeHandler(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Log(testRecord("closed")); err != errHandlerClosed {
+		t.Fatalf("Log after Close returned %v", err)
+	}
+	select {
+	case <-conns:
+		t.Fatal("handler reconnected after Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,188 @@
+package log
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ModuleLevel sets the minimum level of the records logged from the
+// modules matching Pattern.
+type ModuleLevel struct {
+	// Pattern is a glob pattern, as accepted by path.Match, matched
+	// against the package, source file and function of the log call and
+	// against the logger name.
+	Pattern string
+	Level   LEVEL
+}
+
+// ParseModuleLevels parses a comma separated list of pattern=level pairs,
+// such as "request/*=trace,log=warn", as accepted by ModuleFilterHandler.
+// This allows the levels to be set from a flag or environment variable.
+func ParseModuleLevels(spec string) ([]ModuleLevel, error) {
+	var rules []ModuleLevel
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, level, ok := strings.Cut(entry, "=")
+		pattern, level = strings.TrimSpace(pattern), strings.TrimSpace(level)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("log: invalid module level %q, want pattern=level", entry)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("log: invalid module pattern %q: %v", pattern, err)
+		}
+		lvl, err := LevelFromString(level)
+		if err != nil {
+			return nil, fmt.Errorf("log: invalid module level %q: %v", entry, err)
+		}
+		rules = append(rules, ModuleLevel{Pattern: pattern, Level: lvl})
+	}
+	return rules, nil
+}
+
+// ModuleFilterHandler returns a handler which writes records to h if they
+// are at or above the level of their module, like the -vmodule flag of
+// glog. The module of a record is matched against the rules in order and
+// the first match decides its level; records matching no rule must be at
+// or above defaultLvl. A rule matching the logger name takes precedence
+// over rules matching the call site.
+//
+// A pattern matches if it matches the whole or a trailing part of the
+// package path, the source file path without ".go" or the function name
+// of the log call, or the name of the logger. For example "request",
+// "toolkit/request" and "request/*" all match calls in the request
+// package, while "request.(*Client).*" matches the methods of its Client.
+//
+// Results are cached per call site, so the cost of matching is paid once
+// for each log statement.
+func ModuleFilterHandler(defaultLvl LEVEL, rules []ModuleLevel, h Handler) Handler {
+	return &moduleFilterHandler{h: h, defaultLvl: defaultLvl, rules: rules}
+}
+
+type moduleFilterHandler struct {
+	h          Handler
+	defaultLvl LEVEL
+	rules      []ModuleLevel
+
+	// callRules and nameRules cache the index of the first rule matching
+	// a program counter or logger name, -1 if none does.
+	callRules sync.Map
+	nameRules sync.Map
+}
+
+func (m *moduleFilterHandler) Log(r *Record) error {
+	if r.Level >= m.level(r) {
+		return m.h.Log(r)
+	}
+	return nil
+}
+
+func (m *moduleFilterHandler) Flush() error {
+	return flushHandler(m.h)
+}
+
+func (m *moduleFilterHandler) Close() error {
+	return closeHandler(m.h)
+}
+
+// level returns the minimum level of the module r was logged from.
+func (m *moduleFilterHandler) level(r *Record) LEVEL {
+	idx := -1
+
+	if frame := r.Call.Frame(); frame.PC != 0 {
+		if v, ok := m.callRules.Load(frame.PC); ok {
+			idx = v.(int)
+		} else {
+			idx = m.match(callNames(frame.Function, frame.File))
+			m.callRules.Store(frame.PC, idx)
+		}
+	}
+
+	// the logger name was chosen explicitly, it's more specific than
+	// the call site
+	if name := loggerName(r); name != "" {
+		var nameIdx int
+		if v, ok := m.nameRules.Load(name); ok {
+			nameIdx = v.(int)
+		} else {
+			nameIdx = m.match([]string{name})
+			m.nameRules.Store(name, nameIdx)
+		}
+		if nameIdx >= 0 {
+			idx = nameIdx
+		}
+	}
+
+	if idx < 0 {
+		return m.defaultLvl
+	}
+	return m.rules[idx].Level
+}
+
+// match returns the index of the first rule matching one of names, or -1.
+func (m *moduleFilterHandler) match(names []string) int {
+	for i, rule := range m.rules {
+		for _, name := range names {
+			if ok, _ := path.Match(rule.Pattern, name); ok {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// loggerName returns the name of the logger which logged r, if any. The
+// name of records which weren't logged by a named logger may be set in
+// their context instead.
+func loggerName(r *Record) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	for i := 0; i+1 < len(r.Context); i += 2 {
+		if r.Context[i] == nameKey {
+			name, _ := r.Context[i+1].(string)
+			return name
+		}
+	}
+	for _, f := range r.Fields {
+		if f.Key == nameKey && f.Type == StringType {
+			return f.String
+		}
+	}
+	return ""
+}
+
+// callNames returns the names a module pattern is matched against for a
+// call of function fn in file: every trailing part of the package path and
+// of the file path without ".go", the function name and the function name
+// qualified with the package name.
+func callNames(fn, file string) []string {
+	var names []string
+
+	// "github.com/x/pkg.(*T).Method" is split after the last slash, at
+	// the first dot
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		pkg := fn[:slash+1+dot]
+		names = appendPathSuffixes(names, pkg)
+		names = append(names, fn, fn[slash+1:], fn[slash+2+dot:])
+	}
+
+	names = appendPathSuffixes(names, strings.TrimSuffix(file, ".go"))
+	return names
+}
+
+// appendPathSuffixes appends p and every part of p following a slash.
+func appendPathSuffixes(names []string, p string) []string {
+	names = append(names, p)
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && i+1 < len(p) {
+			names = append(names, p[i+1:])
+		}
+	}
+	return names
+}
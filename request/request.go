@@ -159,3 +159,37 @@ func (c *Client) Execute(uri string, method Method, data any, res any, headers .
 
 	return resp.StatusCode, nil
 }
+
+// ExecuteRaw sends body as the request body without encoding it and returns
+// the status code and the response body. Headers are set as by Execute,
+// except that no Content-Type is added.
+func (c *Client) ExecuteRaw(uri string, method Method, body io.Reader, headers ...http.Header) (int, []byte, error) {
+	req, err := http.NewRequest(string(method), uri, body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// set request header
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			req.Header[key] = value
+		}
+	} else if len(c.Header) > 0 {
+		for key, value := range c.Header {
+			req.Header[key] = value
+		}
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer resp.Body.Close()
+	byteArray, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, byteArray, nil
+}